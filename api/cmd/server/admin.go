@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/tim/eureka/internal/config"
+	"github.com/tim/eureka/internal/db"
+	"github.com/tim/eureka/internal/service"
+	"github.com/tim/eureka/internal/validate"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bootstrapAdmin sets the password of the seeded admin@local account to
+// pw, but only while it still has the placeholder from the initial
+// migration. A password changed later is never reset on boot.
+func bootstrapAdmin(q *db.Queries, pw string) {
+	if pw == "" {
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
+	if err != nil {
+		log.Fatal(err)
+	}
+	n, err := q.AdminBootstrapPassword(context.Background(), string(hash))
+	if err != nil {
+		slog.Error("admin password set", "err", err)
+	} else if n > 0 {
+		slog.Info("admin@local password set from the admin password setting")
+	}
+}
+
+// passwordArgs parses --email and --password-stdin for create-admin and
+// reset-password and returns the email and the password to set. Without
+// --password-stdin the password is generated and generated is true.
+func passwordArgs(cfg config.Config, name string, args []string) (email, pw string, generated bool) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	emailFlag := fs.String("email", "", "account email")
+	fromStdin := fs.Bool("password-stdin", false, "read the password from the first line of stdin")
+	_ = fs.Parse(args)
+	email, err := validate.Email(*emailFlag)
+	if err != nil {
+		log.Fatalf("%s: --email: %v", name, err)
+	}
+	if !*fromStdin {
+		b := make([]byte, 18)
+		if _, err := rand.Read(b); err != nil {
+			log.Fatal(err)
+		}
+		return email, base64.RawURLEncoding.EncodeToString(b), true
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		log.Fatalf("%s: no password on stdin", name)
+	}
+	pw = strings.TrimRight(line, "\r\n")
+	if err := passwordPolicy(cfg.Passwords).Check(pw, email); err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+	return email, pw, false
+}
+
+// createAdmin adds an admin account. It fails if the email is taken, so an
+// existing account is never overwritten.
+func createAdmin(cfg config.Config, args []string) {
+	email, pw, generated := passwordArgs(cfg, "create-admin", args)
+	hash, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sqlDB := openDB(cfg.Database)
+	defer sqlDB.Close()
+	id, err := db.New(sqlDB).AdminUserCreate(context.Background(), db.AdminUserCreateParams{
+		Email:    email,
+		PassHash: string(hash),
+		Role:     db.UserRoleAdm,
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		log.Fatalf("create-admin: %s already exists; use reset-password", email)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("created admin %s (%s)\n", email, id)
+	if generated {
+		fmt.Printf("password: %s\n", pw)
+	}
+}
+
+// resetPassword sets a new password for an account, ends its sessions and
+// clears any lockout.
+func resetPassword(cfg config.Config, args []string) {
+	email, pw, generated := passwordArgs(cfg, "reset-password", args)
+	hash, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sqlDB := openDB(cfg.Database)
+	defer sqlDB.Close()
+	ctx := context.Background()
+	q := db.New(sqlDB)
+	u, err := q.UserByEmail(ctx, email)
+	if err != nil {
+		log.Fatalf("reset-password: %s: no such user", email)
+	}
+	if err := q.UserSetPassword(ctx, db.UserSetPasswordParams{Column1: u.ID, PassHash: string(hash)}); err != nil {
+		log.Fatal(err)
+	}
+	if err := q.UserUnlock(ctx, u.ID); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("password reset for %s\n", email)
+	if generated {
+		fmt.Printf("password: %s\n", pw)
+	}
+}
+
+// reindexTags rebuilds page_tags from the bodies of all pages. serve does
+// this once per database; this also fixes stale rows later.
+func reindexTags(cfg config.Config) {
+	sqlDB := openDB(cfg.Database)
+	defer sqlDB.Close()
+	svc := &service.Service{Q: db.New(sqlDB)}
+	n, err := svc.ReindexTags(context.Background())
+	if err != nil {
+		log.Fatalf("reindex-tags: %v", err)
+	}
+	fmt.Printf("reindexed tags of %d pages\n", n)
+}
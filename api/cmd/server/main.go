@@ -2,74 +2,371 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"database/sql"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/tim/eureka/internal/auth"
+	"github.com/tim/eureka/internal/buildinfo"
+	"github.com/tim/eureka/internal/config"
 	"github.com/tim/eureka/internal/db"
+	"github.com/tim/eureka/internal/health"
 	httpx "github.com/tim/eureka/internal/http"
+	"github.com/tim/eureka/internal/mail"
+	"github.com/tim/eureka/internal/metrics"
+	"github.com/tim/eureka/internal/oidc"
 	"github.com/tim/eureka/internal/service"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/tim/eureka/internal/throttle"
+	"github.com/tim/eureka/internal/tracing"
+	"github.com/tim/eureka/internal/validate"
 )
 
+const usage = `usage: api [--config FILE] [command] [flags]
+
+commands:
+  serve [--migrate]                           run the HTTP server (the default)
+  migrate up | down [N|all] | status | force V
+  create-admin --email E [--password-stdin]   create an admin account
+  reset-password --email E [--password-stdin] set a new password for an account
+  reindex-tags                                rebuild the hashtag index of every page
+  config                                      print the settings, secrets redacted
+
+Settings come from FILE (.yaml, .yml or .toml; CONFIG_FILE by default) and
+then from the environment. Without --password-stdin a random password is
+generated and printed.
+`
+
 func main() {
-	addr := env("API_ADDR", ":8080")
-	dsn := mustEnv("DATABASE_URL")
-	sec := mustEnv("JWT_SECRET")
-	adminPw := mustEnv("ADMIN_PASSWORD")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "settings file")
+	flag.Parse()
+	args := flag.Args()
+	cmd := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+	if cmd == "help" {
+		fmt.Print(usage)
+		return
+	}
 
-	sqlDB, err := sql.Open("pgx", dsn)
+	cfg, err := config.Load(*configFile)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("config: %v", err)
 	}
-	defer sqlDB.Close()
-	sqlDB.SetMaxOpenConns(10)
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetConnMaxLifetime(30 * time.Minute)
-	if err := sqlDB.Ping(); err != nil {
-		log.Fatal(err)
+	// Only the server needs every setting; the admin commands need the
+	// database.
+	if err := cfg.Validate(); err != nil && (cmd == "serve" || cmd == "config" || cfg.Database.URL == "") {
+		log.Fatalf("config:\n%v", err)
+	}
+	switch cmd {
+	case "serve":
+		serve(cfg, args)
+	case "migrate":
+		migrateCmd(cfg, args)
+	case "create-admin":
+		createAdmin(cfg, args)
+	case "reset-password":
+		resetPassword(cfg, args)
+	case "reindex-tags":
+		reindexTags(cfg)
+	case "config":
+		b, err := cfg.Redacted()
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Stdout.Write(b)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
 	}
+}
 
-	q := db.New(sqlDB)
+func serve(cfg config.Config, args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	migrateFirst := fs.Bool("migrate", false, "apply pending migrations before serving")
+	_ = fs.Parse(args)
+	setupLog(cfg.Log)
+	slog.Info("starting", "version", buildinfo.Version, "commit", buildinfo.Get().Commit)
 
-	hash, _ := bcrypt.GenerateFromPassword([]byte(adminPw), bcrypt.DefaultCost)
-	if err := q.AdminSetPassword(context.Background(), string(hash)); err != nil {
-		log.Printf("admin password set: %v", err)
+	keys := jwtKeys(cfg.JWT)
+	stopTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("tracing", "err", err)
 	}
 
-	svc := &service.Service{Q: q, PG: sqlDB}
-	router := httpx.Router(svc, sec)
+	sqlDB := openDB(cfg.Database)
+	defer sqlDB.Close()
 
-	srv := &http.Server{Addr: addr, Handler: router}
+	m := migrator(sqlDB)
+	if *migrateFirst {
+		if n, err := m.Up(context.Background()); err != nil {
+			fatal("migrate", "err", err)
+		} else if n > 0 {
+			slog.Info("migrations applied", "count", n)
+		}
+	} else if v, _, err := m.Version(context.Background()); err == nil && v < m.Latest() {
+		slog.Warn("database schema is behind: run migrate up", "version", v, "expected", m.Latest())
+	}
+
+	q := db.New(tracing.DB(sqlDB))
+	bootstrapAdmin(q, cfg.Admin.Password)
+
+	svc := &service.Service{
+		Q:            q,
+		PG:           sqlDB,
+		Mail:         mailer(cfg.Mail),
+		AppURL:       cfg.AppURL,
+		Passwords:    passwordPolicy(cfg.Passwords),
+		Registration: cfg.Registration.Mode,
+		VerifyEmail:  cfg.Registration.VerifyEmail,
+		Limits:       loginLimits(cfg.Login, cfg.Server.TrustProxyHeaders),
+		SSO:          sso(cfg.OIDC),
+		MaxImage:     cfg.Uploads.MaxImageBytes,
+	}
+	if cfg.Trash.Retention > 0 {
+		go svc.PurgeTrashEvery(context.Background(), time.Hour, cfg.Trash.Retention)
+	}
+	// Pages written before hashtags were indexed have no page_tags rows.
 	go func() {
-		log.Printf("api %s", addr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatal(err)
+		if n, err := svc.BackfillTags(context.Background()); err != nil {
+			slog.Error("tag index", "err", err)
+		} else if n > 0 {
+			slog.Info("tags indexed", "pages", n)
+		}
+	}()
+	probes := &health.Health{
+		Checks:  []health.Check{health.Database(sqlDB), health.Schema(m), health.Images(q)},
+		Timeout: cfg.Server.ReadyTimeout,
+	}
+	opts := httpx.Options{
+		TokenTTL:    cfg.JWT.TTL,
+		CORSOrigins: cfg.Server.CORSOrigins,
+		LogSample:   cfg.Log.SampleRatio,
+		Health:      probes,
+	}
+	var metricsSrv *http.Server
+	if mc := cfg.Metrics; mc.Enabled() {
+		h := metrics.Handler(sqlDB)
+		if mc.Token != "" {
+			h = metrics.RequireToken(mc.Token, h)
+		}
+		if mc.Addr != "" {
+			mux := http.NewServeMux()
+			mux.Handle("GET /metrics", h)
+			metricsSrv = &http.Server{Addr: mc.Addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+			go func() {
+				slog.Info("metrics listening", "addr", mc.Addr)
+				if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					fatal("metrics", "err", err)
+				}
+			}()
+		} else {
+			opts.Metrics = h
+		}
+	}
+	router := httpx.Router(svc, keys, opts)
+
+	srv := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           router,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	ctx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	if t := cfg.Server.TLS; t.Enabled() {
+		certs, err := newCertReloader(t.CertFile, t.KeyFile)
+		if err != nil {
+			fatal("tls", "err", err)
+		}
+		go certs.watch(ctx, t.Reload)
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.getCertificate}
+	}
+	go func() {
+		var err error
+		if srv.TLSConfig != nil {
+			slog.Info("api listening", "addr", srv.Addr, "tls", true)
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			slog.Info("api listening", "addr", srv.Addr)
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			fatal("api", "err", err)
 		}
 	}()
 
 	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	<-stop
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// Fail readiness first and give load balancers DrainDelay to notice
+	// before the listener closes.
+	probes.Drain()
+	slog.Info("shutting down", "drain_delay", cfg.Server.DrainDelay)
+	time.Sleep(cfg.Server.DrainDelay)
+	shutdown, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
-	_ = srv.Shutdown(ctx)
+	_ = srv.Shutdown(shutdown)
+	if metricsSrv != nil {
+		_ = metricsSrv.Shutdown(shutdown)
+	}
+	if err := stopTracing(shutdown); err != nil {
+		slog.Error("tracing shutdown", "err", err)
+	}
 }
 
-func env(k, def string) string {
-	if v := os.Getenv(k); v != "" {
-		return v
+// openDB connects to the database and sizes its pool.
+func openDB(c config.Database) *sql.DB {
+	sqlDB, err := sql.Open("pgx", c.URL)
+	if err != nil {
+		fatal("database", "err", err)
+	}
+	sqlDB.SetMaxOpenConns(c.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(c.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(c.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	if err := sqlDB.Ping(); err != nil {
+		fatal("database", "err", err)
+	}
+	return sqlDB
+}
+
+// mailer picks SMTP when an SMTP address is set, otherwise writes mail to
+// the mail directory or, failing that, only notes it in the log, so reset
+// and verification links never reach anyone.
+func mailer(c config.Mail) mail.Mailer {
+	if c.SMTPAddr != "" {
+		return &mail.SMTP{
+			Addr:     c.SMTPAddr,
+			From:     c.From,
+			Username: c.SMTPUser,
+			Password: c.SMTPPassword,
+		}
+	}
+	if c.Dir != "" {
+		return &mail.File{Dir: c.Dir, From: c.From}
+	}
+	slog.Warn("mail is not delivered; set SMTP_ADDR, or MAIL_DIR in development")
+	return mail.Log{}
+}
+
+// passwordPolicy builds the policy from the minimum length and an optional
+// denylist file added to the built-in list.
+func passwordPolicy(c config.Passwords) validate.PasswordPolicy {
+	p := validate.DefaultPolicy(c.MinLength)
+	if c.Denylist != "" {
+		if err := p.LoadDenyList(c.Denylist); err != nil {
+			fatal("password denylist", "err", err)
+		}
+	}
+	return p
+}
+
+// loginLimits builds the brute-force limits. Per IP and per email, the
+// first FreeAttempts failures are free, then the wait doubles from one
+// second up to a minute. LockAfter failures lock the account for
+// LockDuration.
+func loginLimits(c config.Login, trustProxy bool) service.LoginLimits {
+	return service.LoginLimits{
+		PerIP:      throttle.New(c.FreeAttempts*4, time.Second, time.Minute, time.Hour),
+		PerAccount: throttle.New(c.FreeAttempts, time.Second, time.Minute, time.Hour),
+		LockAfter:  c.LockAfter,
+		LockFor:    c.LockDuration,
+		TrustProxy: trustProxy,
+	}
+}
+
+// jwtKeys builds the JWT key set. Tokens are signed with the PEM private
+// key in SigningKey (Ed25519 or RSA) or, without one, with Secret (HS256).
+// The PreviousKeys files, and Secret once a signing key is set, keep
+// verifying tokens for KeyGrace after the rotation: RotatedAt or, when that
+// is unset, the time the signing key file was last written. Restarts do not
+// extend the grace.
+func jwtKeys(c config.JWT) *auth.Keys {
+	var signing auth.Key
+	var retired []auth.Key
+	if c.SigningKey != "" {
+		var err error
+		if signing, err = auth.LoadKey(c.SigningKey); err != nil {
+			fatal("jwt signing key", "err", err)
+		}
+		if c.Secret != "" {
+			retired = append(retired, auth.HMACKey(c.Secret))
+		}
+	} else {
+		signing = auth.HMACKey(c.Secret)
+	}
+	for _, path := range c.PreviousKeys {
+		k, err := auth.LoadKey(path)
+		if err != nil {
+			fatal("jwt previous keys", "err", err)
+		}
+		retired = append(retired, k)
+	}
+	if len(retired) > 0 {
+		rotated := c.RotatedAt
+		if rotated.IsZero() && c.SigningKey != "" {
+			fi, err := os.Stat(c.SigningKey)
+			if err != nil {
+				fatal("jwt signing key", "err", err)
+			}
+			rotated = fi.ModTime()
+		}
+		if rotated.IsZero() {
+			fatal("jwt previous keys need jwt.rotated_at (JWT_ROTATED_AT) when signing with jwt.secret")
+		}
+		until := rotated.Add(c.KeyGrace)
+		for i := range retired {
+			retired[i].Until = until
+			if time.Now().After(until) {
+				slog.Warn("retired jwt key is past its grace period and can be removed",
+					"kid", retired[i].ID, "until", until)
+			}
+		}
 	}
-	return def
+	keys, err := auth.NewKeys(signing, retired...)
+	if err != nil {
+		fatal("jwt keys", "err", err)
+	}
+	return keys
 }
-func mustEnv(k string) string {
-	v := os.Getenv(k)
-	if v == "" {
-		log.Fatalf("%s empty", k)
+
+// sso sets up OpenID Connect login when an issuer is set.
+func sso(c config.OIDC) service.SSO {
+	if c.Issuer == "" {
+		return service.SSO{}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	p, err := oidc.New(ctx, oidc.Config{
+		Issuer:       c.Issuer,
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		RedirectURL:  c.RedirectURL,
+	})
+	if err != nil {
+		fatal("oidc", "err", err)
+	}
+	var domains []string
+	for _, d := range c.AllowedDomains {
+		domains = append(domains, strings.ToLower(d))
+	}
+	return service.SSO{
+		Provider:  p,
+		Provision: c.AutoProvision,
+		Domains:   domains,
 	}
-	return v
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/tim/eureka/internal/config"
+	"github.com/tim/eureka/internal/migrate"
+	"github.com/tim/eureka/migrations"
+)
+
+func migrator(sqlDB *sql.DB) *migrate.Migrator {
+	ms, err := migrate.Load(migrations.FS)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return &migrate.Migrator{DB: sqlDB, Migrations: ms}
+}
+
+// migrateCmd runs migrate up, down [N|all], status or force V.
+func migrateCmd(cfg config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	sqlDB := openDB(cfg.Database)
+	defer sqlDB.Close()
+	m := migrator(sqlDB)
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		n, err := m.Up(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("applied %d migrations\n", n)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if args[1] == "all" {
+				steps = len(m.Migrations)
+			} else if n, err := strconv.Atoi(args[1]); err == nil && n > 0 {
+				steps = n
+			} else {
+				log.Fatalf("migrate down: bad step count %q", args[1])
+			}
+		}
+		n, err := m.Down(ctx, steps)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("rolled back %d migrations\n", n)
+	case "status":
+		st, err := m.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dirty := ""
+		if st.Dirty {
+			dirty = " (dirty)"
+		}
+		fmt.Printf("version %d of %d%s\n", st.Version, m.Latest(), dirty)
+		for i, mg := range m.Migrations {
+			mark := " "
+			if st.Applied[i] {
+				mark = "x"
+			}
+			fmt.Printf("[%s] %03d_%s\n", mark, mg.Version, mg.Name)
+		}
+	case "force":
+		if len(args) < 2 {
+			log.Fatal("migrate force: version required")
+		}
+		v, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil {
+			log.Fatalf("migrate force: bad version %q", args[1])
+		}
+		if err := m.Force(ctx, uint(v)); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("version set to %d\n", v)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
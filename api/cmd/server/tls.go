@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader serves a certificate from files and re-reads them when
+// either changes, so a renewed certificate is used without a restart.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newest is the later modification time of the two files.
+func (c *certReloader) newest() (time.Time, error) {
+	var t time.Time
+	for _, f := range []string{c.certFile, c.keyFile} {
+		st, err := os.Stat(f)
+		if err != nil {
+			return t, err
+		}
+		if st.ModTime().After(t) {
+			t = st.ModTime()
+		}
+	}
+	return t, nil
+}
+
+func (c *certReloader) load() error {
+	mt, err := c.newest()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.cert, c.modTime = &cert, mt
+	c.mu.Unlock()
+	return nil
+}
+
+// watch checks the files at every interval until ctx is done. A pair that
+// fails to load, for instance while only one file has been replaced, keeps
+// the old certificate in use and is retried on the next tick.
+func (c *certReloader) watch(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		mt, err := c.newest()
+		c.mu.RLock()
+		changed := err == nil && !mt.Equal(c.modTime)
+		c.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := c.load(); err != nil {
+			slog.Error("tls reload", "err", err)
+			continue
+		}
+		slog.Info("tls certificate reloaded")
+	}
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
@@ -13,28 +13,92 @@ import (
 type Claims struct {
 	UserID string `json:"uid"`
 	Role   string `json:"role"`
+	// Purpose is empty for access tokens. Tokens with a purpose are only
+	// good for that step and are rejected by AuthMiddleware.
+	Purpose string `json:"pur,omitempty"`
+	// TwoFactor is set on session tokens issued after a second factor.
+	TwoFactor bool `json:"tfa,omitempty"`
 	jwt.RegisteredClaims
 }
 
+const PurposeTwoFactor = "2fa"
+
 type CtxKey string
 
 const (
 	CtxUserID CtxKey = "uid"
 	CtxRole   CtxKey = "role"
+	// CtxScope is ScopeRead or ScopeWrite for personal access tokens and
+	// empty for login sessions.
+	CtxScope CtxKey = "scope"
+	// CtxTwoFactor is true for login sessions that passed a second factor.
+	CtxTwoFactor CtxKey = "tfa"
+	// CtxTwoFactorPending is true when the 2FA policy covers the caller's
+	// role but the request does not meet it; see Can.
+	CtxTwoFactorPending CtxKey = "tfa_pending"
+)
+
+// Personal access tokens start with TokenPrefix, which tells them apart
+// from JWTs.
+const TokenPrefix = "eur_"
+
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
 )
 
-func MakeToken(secret, uid, role string, ttl time.Duration) (string, error) {
-	claims := &Claims{
-		UserID: uid, Role: role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+// TokenLookupFunc resolves a personal access token. An error rejects it.
+type TokenLookupFunc func(ctx context.Context, token string) (uid, role, scope string, err error)
+
+func MakeToken(keys *Keys, uid, role string, ttl time.Duration) (string, error) {
+	return makeToken(keys, &Claims{UserID: uid, Role: role}, ttl)
+}
+
+// MakeTwoFactorToken returns a session token for a login that passed the
+// second factor, as required by routes behind a 2FA policy.
+func MakeTwoFactorToken(keys *Keys, uid, role string, ttl time.Duration) (string, error) {
+	return makeToken(keys, &Claims{UserID: uid, Role: role, TwoFactor: true}, ttl)
+}
+
+// MakeChallenge returns a short-lived token that proves the password step
+// of a two-factor login for uid.
+func MakeChallenge(keys *Keys, uid string, ttl time.Duration) (string, error) {
+	return makeToken(keys, &Claims{UserID: uid, Purpose: PurposeTwoFactor}, ttl)
+}
+
+func makeToken(keys *Keys, claims *Claims, ttl time.Duration) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
 	}
-	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	return keys.sign(claims)
+}
+
+// ParseChallenge returns the user ID of a valid token from MakeChallenge.
+func ParseChallenge(keys *Keys, tok string) (string, error) {
+	claims, err := parse(keys, tok)
+	if err != nil {
+		return "", err
+	}
+	if claims.Purpose != PurposeTwoFactor {
+		return "", errors.New("not a challenge token")
+	}
+	return claims.UserID, nil
+}
+
+func parse(keys *Keys, tok string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tok, claims, keys.keyFunc)
+	return claims, err
 }
 
-func AuthMiddleware(secret string) func(http.Handler) http.Handler {
+// RevokedAtFunc returns the time before which tokens of a user are no longer
+// accepted. An error rejects the token, e.g. for a deleted or disabled user.
+type RevokedAtFunc func(ctx context.Context, uid string) (time.Time, error)
+
+// AuthMiddleware accepts a session JWT or, when lookup is set, a personal
+// access token.
+func AuthMiddleware(keys *Keys, revokedAt RevokedAtFunc, lookup TokenLookupFunc) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			h := r.Header.Get("Authorization")
@@ -43,24 +107,83 @@ func AuthMiddleware(secret string) func(http.Handler) http.Handler {
 				return
 			}
 			tok := strings.TrimPrefix(h, "Bearer ")
-			claims := &Claims{}
-			_, err := jwt.ParseWithClaims(tok, claims, func(t *jwt.Token) (any, error) {
-				if t.Method != jwt.SigningMethodHS256 {
-					return nil, errors.New("alg")
+			if lookup != nil && strings.HasPrefix(tok, TokenPrefix) {
+				uid, role, scope, err := lookup(r.Context(), tok)
+				if err != nil {
+					http.Error(w, "bad token", http.StatusUnauthorized)
+					return
 				}
-				return []byte(secret), nil
-			})
-			if err != nil {
+				ctx := context.WithValue(r.Context(), CtxUserID, uid)
+				ctx = context.WithValue(ctx, CtxRole, role)
+				ctx = context.WithValue(ctx, CtxScope, scope)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+			claims, err := parse(keys, tok)
+			if err != nil || claims.Purpose != "" {
 				http.Error(w, "bad token", http.StatusUnauthorized)
 				return
 			}
+			if revokedAt != nil && !issuedAfter(r.Context(), claims, revokedAt) {
+				http.Error(w, "revoked token", http.StatusUnauthorized)
+				return
+			}
 			ctx := context.WithValue(r.Context(), CtxUserID, claims.UserID)
 			ctx = context.WithValue(ctx, CtxRole, claims.Role)
+			ctx = context.WithValue(ctx, CtxTwoFactor, claims.TwoFactor)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// TwoFactorDone reports whether the caller in ctx signed in with a second
+// factor. It is never true for personal access tokens.
+func TwoFactorDone(ctx context.Context) bool {
+	done, _ := ctx.Value(CtxTwoFactor).(bool)
+	return done
+}
+
+// issuedAfter reports whether the token was issued after the user's tokens
+// were last revoked. iat has second precision, so the revocation time is
+// truncated to let a token issued right after it through.
+func issuedAfter(ctx context.Context, claims *Claims, revokedAt RevokedAtFunc) bool {
+	if claims.IssuedAt == nil {
+		return false
+	}
+	at, err := revokedAt(ctx, claims.UserID)
+	if err != nil {
+		return false
+	}
+	return !claims.IssuedAt.Time.Before(at.Truncate(time.Second))
+}
+
+// RequireWriteScope rejects requests that change data when they carry a
+// read-only access token.
+func RequireWriteScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if scope, _ := r.Context().Value(CtxScope).(string); scope == ScopeRead {
+				http.Error(w, "read-only token", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireSession rejects access tokens, for routes that manage credentials.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if scope, _ := r.Context().Value(CtxScope).(string); scope != "" {
+			http.Error(w, "not allowed with an access token", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func RequireRole(role string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
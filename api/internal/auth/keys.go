@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is a JWT key, named in token headers by ID. A key without a private
+// half only verifies. Until, if set, ends a retired key's grace period.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	Until  time.Time
+
+	private any // []byte, ed25519.PrivateKey or *rsa.PrivateKey
+	public  any // []byte, ed25519.PublicKey or *rsa.PublicKey
+}
+
+// HMACKey returns an HS256 key for a shared secret. It is never published.
+func HMACKey(secret string) Key {
+	sum := sha256.Sum256([]byte("eureka kid " + secret))
+	return Key{
+		ID:      "hs-" + hex.EncodeToString(sum[:4]),
+		Method:  jwt.SigningMethodHS256,
+		private: []byte(secret),
+		public:  []byte(secret),
+	}
+}
+
+// LoadKey reads an Ed25519 or RSA key from a PEM file: a private key
+// (PKCS#8, or PKCS#1 for RSA) to sign, or a public key to only verify. The
+// ID is derived from the public key, so it is the same on every server.
+func LoadKey(path string) (Key, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return Key{}, fmt.Errorf("%s: no PEM data", path)
+	}
+	var k Key
+	switch block.Type {
+	case "PRIVATE KEY":
+		pk, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, fmt.Errorf("%s: %w", path, err)
+		}
+		k.private = pk
+		switch pk := pk.(type) {
+		case ed25519.PrivateKey:
+			k.public = pk.Public()
+		case *rsa.PrivateKey:
+			k.public = pk.Public()
+		}
+	case "RSA PRIVATE KEY":
+		pk, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, fmt.Errorf("%s: %w", path, err)
+		}
+		k.private, k.public = pk, pk.Public()
+	case "PUBLIC KEY":
+		if k.public, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return Key{}, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return Key{}, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+
+	switch pub := k.public.(type) {
+	case ed25519.PublicKey:
+		k.Method = jwt.SigningMethodEdDSA
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return Key{}, fmt.Errorf("%s: RSA keys must have at least 2048 bits", path)
+		}
+		k.Method = jwt.SigningMethodRS256
+	default:
+		return Key{}, fmt.Errorf("%s: only Ed25519 and RSA keys are supported", path)
+	}
+	der, err := x509.MarshalPKIXPublicKey(k.public)
+	if err != nil {
+		return Key{}, err
+	}
+	sum := sha256.Sum256(der)
+	k.ID = base64.RawURLEncoding.EncodeToString(sum[:12])
+	return k, nil
+}
+
+// Keys signs tokens with one key and verifies them with that key and any
+// retired keys still in their grace period.
+type Keys struct {
+	signing Key
+	byID    map[string]Key
+	noKID   *Key // verifies HS256 tokens issued before tokens carried a kid
+}
+
+func NewKeys(signing Key, retired ...Key) (*Keys, error) {
+	if signing.private == nil {
+		return nil, errors.New("signing key has no private key")
+	}
+	ks := &Keys{signing: signing, byID: map[string]Key{}}
+	for _, k := range append([]Key{signing}, retired...) {
+		if _, dup := ks.byID[k.ID]; dup {
+			return nil, fmt.Errorf("duplicate key %s", k.ID)
+		}
+		ks.byID[k.ID] = k
+		if k.Method == jwt.SigningMethodHS256 && ks.noKID == nil {
+			k := k
+			ks.noKID = &k
+		}
+	}
+	return ks, nil
+}
+
+func (ks *Keys) sign(claims *Claims) (string, error) {
+	t := jwt.NewWithClaims(ks.signing.Method, claims)
+	t.Header["kid"] = ks.signing.ID
+	return t.SignedString(ks.signing.private)
+}
+
+func (ks *Keys) keyFunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	k, ok := ks.byID[kid]
+	if kid == "" && ks.noKID != nil {
+		k, ok = *ks.noKID, true
+	}
+	if !ok {
+		return nil, errors.New("unknown key")
+	}
+	if t.Method.Alg() != k.Method.Alg() {
+		return nil, errors.New("alg")
+	}
+	if !k.Until.IsZero() && time.Now().After(k.Until) {
+		return nil, errors.New("retired key")
+	}
+	return k.public, nil
+}
+
+// JWK is a public key in JSON Web Key form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS returns the public keys that currently verify tokens, for
+// /.well-known/jwks.json. HMAC keys are secret and left out.
+func (ks *Keys) JWKS() map[string][]JWK {
+	keys := []JWK{}
+	for _, k := range ks.byID {
+		if !k.Until.IsZero() && time.Now().After(k.Until) {
+			continue
+		}
+		j := JWK{Kid: k.ID, Alg: k.Method.Alg(), Use: "sig"}
+		switch pub := k.public.(type) {
+		case ed25519.PublicKey:
+			j.Kty, j.Crv, j.X = "OKP", "Ed25519", base64.RawURLEncoding.EncodeToString(pub)
+		case *rsa.PublicKey:
+			j.Kty = "RSA"
+			j.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			j.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		default:
+			continue
+		}
+		keys = append(keys, j)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Kid < keys[j].Kid })
+	return map[string][]JWK{"keys": keys}
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// edKey writes a new Ed25519 private key to a PEM file and loads it.
+func edKey(t *testing.T) Key {
+	_, pk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	k, err := LoadKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func mustKeys(t *testing.T, signing Key, retired ...Key) *Keys {
+	ks, err := NewKeys(signing, retired...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+func token(t *testing.T, ks *Keys) string {
+	tok, err := MakeToken(ks, "u1", "user", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tok
+}
+
+func TestKeysSelectByKID(t *testing.T) {
+	old, cur := HMACKey("old secret"), edKey(t)
+	ks := mustKeys(t, cur, old)
+
+	for name, tok := range map[string]string{
+		"signing": token(t, ks),
+		"retired": token(t, mustKeys(t, old)),
+	} {
+		c, err := parse(ks, tok)
+		if err != nil || c.UserID != "u1" {
+			t.Errorf("%s: got %v, %v", name, c, err)
+		}
+	}
+	if _, err := parse(ks, token(t, mustKeys(t, HMACKey("other")))); err == nil {
+		t.Error("a token from an unknown key verified")
+	}
+}
+
+func TestKeysRejectAlgMismatch(t *testing.T) {
+	ed, hs := edKey(t), HMACKey("secret")
+	ks := mustKeys(t, ed, hs)
+	for _, tc := range []struct {
+		method jwt.SigningMethod
+		kid    string
+	}{
+		{jwt.SigningMethodHS256, ed.ID},
+		{jwt.SigningMethodEdDSA, hs.ID},
+		{jwt.SigningMethodRS256, ed.ID},
+	} {
+		tok := &jwt.Token{Method: tc.method, Header: map[string]any{"kid": tc.kid}}
+		if _, err := ks.keyFunc(tok); err == nil {
+			t.Errorf("%s accepted for key %s", tc.method.Alg(), tc.kid)
+		}
+	}
+}
+
+func TestKeysRetiredKeyExpires(t *testing.T) {
+	old := HMACKey("old secret")
+	tok := token(t, mustKeys(t, old))
+
+	old.Until = time.Now().Add(time.Hour)
+	if _, err := parse(mustKeys(t, edKey(t), old), tok); err != nil {
+		t.Errorf("in grace: %v", err)
+	}
+	old.Until = time.Now().Add(-time.Second)
+	if _, err := parse(mustKeys(t, edKey(t), old), tok); err == nil {
+		t.Error("a token from a key past its grace verified")
+	}
+}
+
+func TestKeysNoKIDFallback(t *testing.T) {
+	secret := "shared secret"
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{UserID: "u1"}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err := parse(mustKeys(t, edKey(t), HMACKey(secret)), tok); err != nil || c.UserID != "u1" {
+		t.Errorf("with the HMAC key: got %v, %v", c, err)
+	}
+	if _, err := parse(mustKeys(t, edKey(t)), tok); err == nil {
+		t.Error("a token without kid verified with no HMAC key")
+	}
+}
+
+func TestJWKSLeavesOutHMAC(t *testing.T) {
+	ed := edKey(t)
+	expired := edKey(t)
+	expired.Until = time.Now().Add(-time.Second)
+	keys := mustKeys(t, ed, HMACKey("secret"), expired).JWKS()["keys"]
+	if len(keys) != 1 || keys[0].Kid != ed.ID || keys[0].Kty != "OKP" || keys[0].X == "" {
+		t.Fatalf("got %+v", keys)
+	}
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"sort"
+)
+
+type Permission string
+
+const (
+	PagesWrite     Permission = "pages.write"      // create and edit own pages
+	PagesReadAny   Permission = "pages.read.any"   // read every user's pages
+	PagesWriteAny  Permission = "pages.write.any"  // edit every user's pages
+	PagesDeleteAny Permission = "pages.delete.any" // delete every user's pages
+	PagesTransfer  Permission = "pages.transfer"   // change a page's owner
+	UsersRead      Permission = "users.read"       // list users and locked accounts
+	UsersManage    Permission = "users.manage"     // create, delete, unlock users, assign roles, invites
+	SettingsManage Permission = "settings.manage"  // instance settings
+	AuditRead      Permission = "audit.read"       // the audit log
+)
+
+// roles maps each built-in role to its permissions. Every user can read
+// their own pages; "adm" has every permission.
+var roles = map[string][]Permission{
+	"user":   {PagesWrite},
+	"viewer": {PagesReadAny},
+	"moderator": {
+		PagesWrite, PagesReadAny, PagesWriteAny, PagesDeleteAny, PagesTransfer, UsersRead,
+	},
+	"auditor": {PagesReadAny, UsersRead, AuditRead},
+	"adm": {
+		PagesWrite, PagesReadAny, PagesWriteAny, PagesDeleteAny, PagesTransfer,
+		UsersRead, UsersManage, SettingsManage, AuditRead,
+	},
+}
+
+// Roles returns the built-in roles and their permissions.
+func Roles() map[string][]Permission {
+	out := make(map[string][]Permission, len(roles))
+	for r, ps := range roles {
+		out[r] = append([]Permission(nil), ps...)
+	}
+	return out
+}
+
+// ValidRole reports whether role is a built-in role.
+func ValidRole(role string) bool {
+	_, ok := roles[role]
+	return ok
+}
+
+// Has reports whether role grants p.
+func Has(role string, p Permission) bool {
+	for _, q := range roles[role] {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Privileged reports whether role has any permission beyond editing its own
+// pages, i.e. can reach a route guarded by one. The 2FA policy covers these
+// roles.
+func Privileged(role string) bool {
+	for _, p := range roles[role] {
+		if p != PagesWrite {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns the sorted permissions of role.
+func Permissions(role string) []Permission {
+	ps := append([]Permission{}, roles[role]...)
+	sort.Slice(ps, func(i, j int) bool { return ps[i] < ps[j] })
+	return ps
+}
+
+// Can reports whether the caller in ctx has p. A caller whose role the 2FA
+// policy covers but who has not met it keeps only PagesWrite, so the policy
+// holds wherever a privileged permission is used, not just on some routes.
+func Can(ctx context.Context, p Permission) bool {
+	role, _ := ctx.Value(CtxRole).(string)
+	if p != PagesWrite && TwoFactorPending(ctx) {
+		return false
+	}
+	return Has(role, p)
+}
+
+// TwoFactorPending reports whether the caller in ctx is held back by the
+// 2FA policy.
+func TwoFactorPending(ctx context.Context) bool {
+	pending, _ := ctx.Value(CtxTwoFactorPending).(bool)
+	return pending
+}
+
+func RequirePermission(p Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !Can(r.Context(), p) {
+				role, _ := r.Context().Value(CtxRole).(string)
+				if Has(role, p) {
+					http.Error(w, "two-factor authentication required", http.StatusForbidden)
+					return
+				}
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,42 @@
+// Package buildinfo holds the version of the running binary. Release
+// builds stamp it with
+//
+//	go build -ldflags "-X github.com/tim/eureka/internal/buildinfo.Version=v1.2.0 \
+//	  -X github.com/tim/eureka/internal/buildinfo.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/tim/eureka/internal/buildinfo.BuildTime=$(date -u +%FT%TZ)"
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+	Go        string `json:"go"`
+}
+
+// Get returns the stamped values. A commit or build time left unstamped
+// falls back to the VCS details the go command embeds.
+func Get() Info {
+	i := Info{Version: Version, Commit: Commit, BuildTime: BuildTime, Go: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && i.Commit == "":
+				i.Commit = s.Value
+			case s.Key == "vcs.time" && i.BuildTime == "":
+				i.BuildTime = s.Value
+			}
+		}
+	}
+	return i
+}
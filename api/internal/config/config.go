@@ -0,0 +1,494 @@
+// Package config loads the server settings from an optional YAML or TOML
+// file and then from environment variables, which win over the file. The
+// environment variable names are the ones the server has always read, so
+// deployments configured by env alone keep working.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Registration modes, mirrored from the service package so that config
+// does not import it.
+var registrationModes = []string{"open", "invite", "closed"}
+
+type Config struct {
+	Server       Server       `yaml:"server" toml:"server"`
+	Database     Database     `yaml:"database" toml:"database"`
+	JWT          JWT          `yaml:"jwt" toml:"jwt"`
+	AppURL       string       `yaml:"app_url" toml:"app_url" env:"APP_URL"`
+	Admin        Admin        `yaml:"admin" toml:"admin"`
+	Mail         Mail         `yaml:"mail" toml:"mail"`
+	Registration Registration `yaml:"registration" toml:"registration"`
+	Passwords    Passwords    `yaml:"passwords" toml:"passwords"`
+	Login        Login        `yaml:"login" toml:"login"`
+	Uploads      Uploads      `yaml:"uploads" toml:"uploads"`
+	Trash        Trash        `yaml:"trash" toml:"trash"`
+	OIDC         OIDC         `yaml:"oidc" toml:"oidc"`
+	Metrics      Metrics      `yaml:"metrics" toml:"metrics"`
+	Tracing      Tracing      `yaml:"tracing" toml:"tracing"`
+	Log          Log          `yaml:"log" toml:"log"`
+}
+
+type Server struct {
+	Addr              string        `yaml:"addr" toml:"addr" env:"API_ADDR"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"HTTP_READ_TIMEOUT"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	DrainDelay        time.Duration `yaml:"drain_delay" toml:"drain_delay" env:"SHUTDOWN_DRAIN_DELAY"`
+	ReadyTimeout      time.Duration `yaml:"ready_timeout" toml:"ready_timeout" env:"READY_TIMEOUT"`
+	CORSOrigins       []string      `yaml:"cors_origins" toml:"cors_origins" env:"CORS_ORIGINS"`
+	TrustProxyHeaders bool          `yaml:"trust_proxy_headers" toml:"trust_proxy_headers" env:"TRUST_PROXY_HEADERS"`
+	TLS               TLS           `yaml:"tls" toml:"tls"`
+}
+
+// TLS serves HTTPS when both files are set. They are re-read when they
+// change, so renewed certificates are picked up without a restart.
+type TLS struct {
+	CertFile string        `yaml:"cert_file" toml:"cert_file" env:"TLS_CERT_FILE"`
+	KeyFile  string        `yaml:"key_file" toml:"key_file" env:"TLS_KEY_FILE"`
+	Reload   time.Duration `yaml:"reload" toml:"reload" env:"TLS_RELOAD_INTERVAL"`
+}
+
+func (t TLS) Enabled() bool { return t.CertFile != "" }
+
+type Database struct {
+	URL             string        `yaml:"url" toml:"url" env:"DATABASE_URL" secret:"url"`
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+}
+
+type JWT struct {
+	// Secret signs HS256 tokens when SigningKey is empty, and is a retired
+	// key for KeyGrace when it is set.
+	Secret       string        `yaml:"secret" toml:"secret" env:"JWT_SECRET" secret:"true"`
+	SigningKey   string        `yaml:"signing_key" toml:"signing_key" env:"JWT_SIGNING_KEY"`
+	PreviousKeys []string      `yaml:"previous_keys" toml:"previous_keys" env:"JWT_PREVIOUS_KEYS"`
+	KeyGrace     time.Duration `yaml:"key_grace" toml:"key_grace" env:"JWT_KEY_GRACE"`
+	// RotatedAt is when the signing key took over; retired keys verify until
+	// RotatedAt plus KeyGrace. It defaults to the signing key file's
+	// modification time.
+	RotatedAt time.Time     `yaml:"rotated_at" toml:"rotated_at" env:"JWT_ROTATED_AT"`
+	TTL       time.Duration `yaml:"ttl" toml:"ttl" env:"JWT_TTL"`
+}
+
+type Admin struct {
+	// Password is set on the seeded admin@local on first start only.
+	Password string `yaml:"password" toml:"password" env:"ADMIN_PASSWORD" secret:"true"`
+}
+
+// Mail goes over SMTP when SMTPAddr is set, otherwise to files in Dir.
+// With neither it is not sent; the log only shows recipient and subject.
+type Mail struct {
+	From         string `yaml:"from" toml:"from" env:"MAIL_FROM"`
+	SMTPAddr     string `yaml:"smtp_addr" toml:"smtp_addr" env:"SMTP_ADDR"`
+	SMTPUser     string `yaml:"smtp_user" toml:"smtp_user" env:"SMTP_USER"`
+	SMTPPassword string `yaml:"smtp_password" toml:"smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+	Dir          string `yaml:"dir" toml:"dir" env:"MAIL_DIR"`
+}
+
+type Registration struct {
+	Mode        string `yaml:"mode" toml:"mode" env:"REGISTRATION_MODE"`
+	VerifyEmail bool   `yaml:"verify_email" toml:"verify_email" env:"REQUIRE_EMAIL_VERIFICATION"`
+}
+
+type Passwords struct {
+	MinLength int    `yaml:"min_length" toml:"min_length" env:"PASSWORD_MIN_LENGTH"`
+	Denylist  string `yaml:"denylist" toml:"denylist" env:"PASSWORD_DENYLIST"`
+}
+
+type Login struct {
+	FreeAttempts int           `yaml:"free_attempts" toml:"free_attempts" env:"LOGIN_FREE_ATTEMPTS"`
+	LockAfter    int           `yaml:"lock_after" toml:"lock_after" env:"LOGIN_LOCK_AFTER"`
+	LockDuration time.Duration `yaml:"lock_duration" toml:"lock_duration" env:"LOGIN_LOCK_DURATION"`
+}
+
+type Uploads struct {
+	MaxImageBytes int64 `yaml:"max_image_bytes" toml:"max_image_bytes" env:"MAX_IMAGE_BYTES"`
+}
+
+type Trash struct {
+	// Retention is how long deleted pages stay in the trash; 0 keeps them
+	// until emptied.
+	Retention time.Duration `yaml:"retention" toml:"retention" env:"TRASH_RETENTION"`
+}
+
+// OIDC enables single sign-on when Issuer is set.
+type OIDC struct {
+	Issuer         string   `yaml:"issuer" toml:"issuer" env:"OIDC_ISSUER"`
+	ClientID       string   `yaml:"client_id" toml:"client_id" env:"OIDC_CLIENT_ID"`
+	ClientSecret   string   `yaml:"client_secret" toml:"client_secret" env:"OIDC_CLIENT_SECRET" secret:"true"`
+	RedirectURL    string   `yaml:"redirect_url" toml:"redirect_url" env:"OIDC_REDIRECT_URL"`
+	AutoProvision  bool     `yaml:"auto_provision" toml:"auto_provision" env:"OIDC_AUTO_PROVISION"`
+	AllowedDomains []string `yaml:"allowed_domains" toml:"allowed_domains" env:"OIDC_ALLOWED_DOMAINS"`
+}
+
+// Metrics serves Prometheus metrics at /metrics on Addr, a listener of its
+// own that can stay off the public network, or else on the API address to
+// requests with "Authorization: Bearer Token". When both are set the
+// separate listener asks for the token too. With neither, there is no
+// /metrics.
+type Metrics struct {
+	Addr  string `yaml:"addr" toml:"addr" env:"METRICS_ADDR"`
+	Token string `yaml:"token" toml:"token" env:"METRICS_TOKEN" secret:"true"`
+}
+
+func (m Metrics) Enabled() bool { return m.Addr != "" || m.Token != "" }
+
+// Tracing exports OpenTelemetry spans with Exporter: "otlp" sends them
+// over OTLP/HTTP to Endpoint (or as the standard OTEL_EXPORTER_OTLP_*
+// variables say), "stdout" prints them for local use, and "" turns tracing
+// off. SampleRatio is the share of new traces kept; traces started
+// upstream follow the caller's decision.
+type Tracing struct {
+	Exporter    string  `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER"`
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint" env:"TRACING_OTLP_ENDPOINT"`
+	ServiceName string  `yaml:"service_name" toml:"service_name" env:"OTEL_SERVICE_NAME"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+// Log configures the server's slog output. Level is debug, info, warn or
+// error; Format is json or text. SampleRatio is the share of access log
+// lines kept for requests that succeed; 4xx and 5xx are always logged.
+type Log struct {
+	Level       string  `yaml:"level" toml:"level" env:"LOG_LEVEL"`
+	Format      string  `yaml:"format" toml:"format" env:"LOG_FORMAT"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio" env:"LOG_SAMPLE_RATIO"`
+}
+
+// Default returns the settings used for anything the file and the
+// environment leave out.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:              ":8080",
+			ReadTimeout:       30 * time.Second,
+			ReadHeaderTimeout: 10 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   5 * time.Second,
+			ReadyTimeout:      2 * time.Second,
+			CORSOrigins:       []string{"*"},
+			TLS:               TLS{Reload: time.Minute},
+		},
+		Database: Database{
+			MaxOpenConns:    10,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		JWT: JWT{
+			KeyGrace: 24 * time.Hour,
+			TTL:      24 * time.Hour,
+		},
+		AppURL:       "http://localhost:8082",
+		Mail:         Mail{From: "eureka@localhost"},
+		Registration: Registration{Mode: "open"},
+		Passwords:    Passwords{MinLength: 8},
+		Login:        Login{FreeAttempts: 5, LockAfter: 10, LockDuration: 15 * time.Minute},
+		Uploads:      Uploads{MaxImageBytes: 5 << 20},
+		Trash:        Trash{Retention: 30 * 24 * time.Hour},
+		Tracing:      Tracing{ServiceName: "eureka-api", SampleRatio: 1},
+		Log:          Log{Level: "info", Format: "json", SampleRatio: 1},
+	}
+}
+
+// Load reads path, if not empty, over the defaults and then applies the
+// environment. The file format follows the extension: .yaml, .yml or .toml.
+// Unknown keys in the file are errors, so typos do not pass silently.
+func Load(path string) (Config, error) {
+	c := Default()
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return c, err
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml":
+			dec := yaml.NewDecoder(bytes.NewReader(b))
+			dec.KnownFields(true)
+			if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+				return c, fmt.Errorf("%s: %w", path, err)
+			}
+		case ".toml":
+			md, err := toml.Decode(string(b), &c)
+			if err != nil {
+				return c, fmt.Errorf("%s: %w", path, err)
+			}
+			if un := md.Undecoded(); len(un) > 0 {
+				return c, fmt.Errorf("%s: unknown key %s", path, un[0])
+			}
+		default:
+			return c, fmt.Errorf("%s: want a .yaml, .yml or .toml file", path)
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(&c).Elem()); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// applyEnv sets each field tagged env from its variable when that is set
+// and not empty. Lists are comma-separated; times are RFC 3339.
+func applyEnv(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, fv := t.Field(i), v.Field(i)
+		if f.Type.Kind() == reflect.Struct && f.Type != timeType {
+			if err := applyEnv(fv); err != nil {
+				return err
+			}
+			continue
+		}
+		name := f.Tag.Get("env")
+		s := os.Getenv(name)
+		if name == "" || s == "" {
+			continue
+		}
+		if err := setField(fv, s); err != nil {
+			return fmt.Errorf("%s: bad value %q", name, s)
+		}
+	}
+	return nil
+}
+
+func setField(fv reflect.Value, s string) error {
+	switch fv.Interface().(type) {
+	case string:
+		fv.SetString(s)
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case int, int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+	case time.Time:
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+	case []string:
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		fv.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+	return nil
+}
+
+// Validate reports every problem with c at once.
+func (c Config) Validate() error {
+	var errs []error
+	bad := func(format string, args ...any) { errs = append(errs, fmt.Errorf(format, args...)) }
+
+	if c.Server.Addr == "" {
+		bad("server.addr is required")
+	}
+	for name, d := range map[string]time.Duration{
+		"server.read_timeout":         c.Server.ReadTimeout,
+		"server.read_header_timeout":  c.Server.ReadHeaderTimeout,
+		"server.write_timeout":        c.Server.WriteTimeout,
+		"server.idle_timeout":         c.Server.IdleTimeout,
+		"server.shutdown_timeout":     c.Server.ShutdownTimeout,
+		"server.drain_delay":          c.Server.DrainDelay,
+		"database.conn_max_lifetime":  c.Database.ConnMaxLifetime,
+		"database.conn_max_idle_time": c.Database.ConnMaxIdleTime,
+		"jwt.key_grace":               c.JWT.KeyGrace,
+		"trash.retention":             c.Trash.Retention,
+	} {
+		if d < 0 {
+			bad("%s must not be negative", name)
+		}
+	}
+	for _, o := range c.Server.CORSOrigins {
+		if o == "*" {
+			continue
+		}
+		if u, err := url.Parse(o); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+			bad("server.cors_origins: %q is not * or an http(s)://host[:port] origin", o)
+		}
+	}
+	if (c.Server.TLS.CertFile == "") != (c.Server.TLS.KeyFile == "") {
+		bad("server.tls needs both cert_file and key_file")
+	}
+	if c.Server.ReadyTimeout <= 0 {
+		bad("server.ready_timeout must be positive")
+	}
+	if c.Server.TLS.Enabled() && c.Server.TLS.Reload <= 0 {
+		bad("server.tls.reload must be positive")
+	}
+
+	if c.Database.URL == "" {
+		bad("database.url is required")
+	}
+	if c.Database.MaxOpenConns < 1 {
+		bad("database.max_open_conns must be at least 1")
+	}
+	if c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		bad("database.max_idle_conns must be between 0 and max_open_conns")
+	}
+
+	if c.JWT.Secret == "" && c.JWT.SigningKey == "" {
+		bad("jwt.secret or jwt.signing_key is required")
+	}
+	if c.JWT.TTL <= 0 {
+		bad("jwt.ttl must be positive")
+	}
+
+	if !contains(registrationModes, c.Registration.Mode) {
+		bad("registration.mode must be one of %s", strings.Join(registrationModes, ", "))
+	}
+	if c.Passwords.MinLength < 1 {
+		bad("passwords.min_length must be at least 1")
+	}
+	if c.Login.FreeAttempts < 0 || c.Login.LockAfter < 0 || c.Login.LockDuration < 0 {
+		bad("login settings must not be negative")
+	}
+	if c.Uploads.MaxImageBytes < 1 {
+		bad("uploads.max_image_bytes must be positive")
+	}
+	if c.Metrics.Addr != "" && c.Metrics.Addr == c.Server.Addr {
+		bad("metrics.addr must differ from server.addr; set metrics.token to serve metrics on the API address")
+	}
+	switch c.Tracing.Exporter {
+	case "", "otlp", "stdout":
+	default:
+		bad("tracing.exporter must be otlp, stdout or empty")
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		bad("tracing.sample_ratio must be between 0 and 1")
+	}
+	if c.Tracing.Endpoint != "" {
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || u.Host == "" {
+			bad("tracing.endpoint must be a URL such as http://collector:4318")
+		}
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		bad("log.level must be debug, info, warn or error")
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		bad("log.format must be json or text")
+	}
+	if c.Log.SampleRatio < 0 || c.Log.SampleRatio > 1 {
+		bad("log.sample_ratio must be between 0 and 1")
+	}
+	if c.OIDC.Issuer != "" && (c.OIDC.ClientID == "" || c.OIDC.RedirectURL == "") {
+		bad("oidc needs client_id and redirect_url when issuer is set")
+	}
+	return errors.Join(errs...)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns c as YAML with secrets replaced, for printing.
+func (c Config) Redacted() ([]byte, error) {
+	return yaml.Marshal(node(reflect.ValueOf(c)))
+}
+
+// redact hides a secret. URLs tagged secret:"url" keep everything but the
+// password, in the userinfo or in a password or sslpassword parameter, so
+// the printed settings still show which database is used.
+func redact(kind, s string) string {
+	if kind == "url" {
+		if u, err := url.Parse(s); err == nil && u.Scheme != "" {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), "REDACTED")
+			}
+			q := u.Query()
+			for _, k := range []string{"password", "sslpassword"} {
+				if q.Has(k) {
+					q.Set(k, "REDACTED")
+					u.RawQuery = q.Encode()
+				}
+			}
+			return u.String()
+		}
+	}
+	return "REDACTED"
+}
+
+// node converts v to a YAML node in field order, writing durations as
+// strings such as "15m0s", unset times as null and secrets as "REDACTED".
+func node(v reflect.Value) *yaml.Node {
+	t := v.Type()
+	n := &yaml.Node{Kind: yaml.MappingNode}
+	for i := 0; i < t.NumField(); i++ {
+		f, fv := t.Field(i), v.Field(i)
+		key := &yaml.Node{Kind: yaml.ScalarNode, Value: f.Tag.Get("yaml")}
+		var val *yaml.Node
+		switch x := fv.Interface().(type) {
+		case time.Duration:
+			val = &yaml.Node{Kind: yaml.ScalarNode, Value: x.String()}
+		case time.Time:
+			val = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+			if !x.IsZero() {
+				val = &yaml.Node{Kind: yaml.ScalarNode, Value: x.Format(time.RFC3339)}
+			}
+		default:
+			if f.Type.Kind() == reflect.Struct {
+				val = node(fv)
+				break
+			}
+			val = &yaml.Node{}
+			if err := val.Encode(x); err != nil {
+				val = &yaml.Node{Kind: yaml.ScalarNode, Value: fmt.Sprint(x)}
+			}
+			if secret := f.Tag.Get("secret"); secret != "" && fv.String() != "" {
+				val = &yaml.Node{Kind: yaml.ScalarNode, Value: redact(secret, fv.String())}
+			}
+		}
+		n.Content = append(n.Content, key, val)
+	}
+	return n
+}
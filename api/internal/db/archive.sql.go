@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const archivedPagesList = `-- name: ArchivedPagesList :many
+SELECT id::text, owner_email, name, updated_at, archived_at
+FROM archived_pages
+ORDER BY archived_at DESC, name
+`
+
+type ArchivedPagesListRow struct {
+	ID         string    `json:"id"`
+	OwnerEmail string    `json:"owner_email"`
+	Name       string    `json:"name"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+func (q *Queries) ArchivedPagesList(ctx context.Context) ([]ArchivedPagesListRow, error) {
+	rows, err := q.db.QueryContext(ctx, archivedPagesList)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ArchivedPagesListRow
+	for rows.Next() {
+		var i ArchivedPagesListRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.OwnerEmail,
+			&i.Name,
+			&i.UpdatedAt,
+			&i.ArchivedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const imagesArchiveByUser = `-- name: ImagesArchiveByUser :exec
+INSERT INTO archived_images (id, page_id, name, mime, size_bytes, content, created_at)
+SELECT i.id, i.page_id, i.name, i.mime, i.size_bytes, i.content, i.created_at
+FROM images i JOIN pages p ON p.id=i.page_id
+WHERE p.user_id=$1::uuid
+`
+
+func (q *Queries) ImagesArchiveByUser(ctx context.Context, dollar_1 uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, imagesArchiveByUser, dollar_1)
+	return err
+}
+
+const pagesArchiveByUser = `-- name: PagesArchiveByUser :exec
+INSERT INTO archived_pages (id, owner_id, owner_email, name, body, links, created_at, updated_at)
+SELECT p.id, p.user_id, u.email, p.name, p.body,
+  COALESCE((SELECT jsonb_agg(jsonb_build_object('dest', l.id_dest, 'tag', l.tag, 'anchor', l.anchor, 'origin', l.origin))
+            FROM page_links l WHERE l.id_source=p.id), '[]'),
+  p.created_at, p.updated_at
+FROM pages p JOIN users u ON u.id=p.user_id
+WHERE p.user_id=$1::uuid
+`
+
+func (q *Queries) PagesArchiveByUser(ctx context.Context, dollar_1 uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, pagesArchiveByUser, dollar_1)
+	return err
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+const auditEventCreate = `-- name: AuditEventCreate :exec
+INSERT INTO audit_events (actor_id, actor_email, action, target_type, target_id, request_id, ip, before, after)
+VALUES ($1, COALESCE((SELECT email FROM users WHERE id=$1), ''), $2, $3, $4, $5, $6, $7, $8)
+`
+
+type AuditEventCreateParams struct {
+	ActorID    uuid.NullUUID   `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	RequestID  string          `json:"request_id"`
+	Ip         string          `json:"ip"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+}
+
+func (q *Queries) AuditEventCreate(ctx context.Context, arg AuditEventCreateParams) error {
+	_, err := q.db.ExecContext(ctx, auditEventCreate,
+		arg.ActorID,
+		arg.Action,
+		arg.TargetType,
+		arg.TargetID,
+		arg.RequestID,
+		arg.Ip,
+		arg.Before,
+		arg.After,
+	)
+	return err
+}
+
+const auditEventsList = `-- name: AuditEventsList :many
+SELECT id, at, actor_id, actor_email, action, target_type, target_id, request_id, ip, before, after
+FROM audit_events
+WHERE ($1::text = '' OR action = $1 OR action LIKE $1 || '.%')
+  AND ($2::text = '' OR actor_id::text = $2)
+  AND ($3::text = '' OR target_id = $3)
+  AND ($4::timestamptz IS NULL OR at >= $4)
+  AND ($5::timestamptz IS NULL OR at < $5)
+  AND ($6::bigint = 0 OR id < $6)
+ORDER BY id DESC
+LIMIT $7
+`
+
+type AuditEventsListParams struct {
+	Action   string       `json:"action"`
+	Actor    string       `json:"actor"`
+	Target   string       `json:"target"`
+	Since    sql.NullTime `json:"since"`
+	Until    sql.NullTime `json:"until"`
+	BeforeID int64        `json:"before_id"`
+	Lim      int32        `json:"lim"`
+}
+
+func (q *Queries) AuditEventsList(ctx context.Context, arg AuditEventsListParams) ([]AuditEvent, error) {
+	rows, err := q.db.QueryContext(ctx, auditEventsList,
+		arg.Action,
+		arg.Actor,
+		arg.Target,
+		arg.Since,
+		arg.Until,
+		arg.BeforeID,
+		arg.Lim,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditEvent
+	for rows.Next() {
+		var i AuditEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.At,
+			&i.ActorID,
+			&i.ActorEmail,
+			&i.Action,
+			&i.TargetType,
+			&i.TargetID,
+			&i.RequestID,
+			&i.Ip,
+			&i.Before,
+			&i.After,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
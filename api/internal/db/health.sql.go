@@ -0,0 +1,14 @@
+package db
+
+import (
+	"context"
+)
+
+const imagesReachable = `-- name: ImagesReachable :exec
+SELECT 1 FROM images LIMIT 1
+`
+
+func (q *Queries) ImagesReachable(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, imagesReachable)
+	return err
+}
@@ -8,7 +8,9 @@ import (
 )
 
 const imageByID = `-- name: ImageByID :one
-SELECT id::text, page_id::text, name, mime, size_bytes, content FROM images WHERE id=$1::uuid
+SELECT i.id::text, i.page_id::text, i.name, i.mime, i.size_bytes, i.content
+FROM images i JOIN pages p ON p.id=i.page_id
+WHERE i.id=$1::uuid AND p.deleted_at IS NULL
 `
 
 type ImageByIDRow struct {
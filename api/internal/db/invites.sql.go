@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const inviteCreate = `-- name: InviteCreate :one
+INSERT INTO invites (code_hash, note, created_by, expires_at) VALUES ($1, $2, $3::uuid, $4)
+RETURNING id::text
+`
+
+type InviteCreateParams struct {
+	CodeHash  string       `json:"code_hash"`
+	Note      string       `json:"note"`
+	Column3   uuid.UUID    `json:"column_3"`
+	ExpiresAt sql.NullTime `json:"expires_at"`
+}
+
+func (q *Queries) InviteCreate(ctx context.Context, arg InviteCreateParams) (string, error) {
+	row := q.db.QueryRowContext(ctx, inviteCreate,
+		arg.CodeHash,
+		arg.Note,
+		arg.Column3,
+		arg.ExpiresAt,
+	)
+	var id string
+	err := row.Scan(&id)
+	return id, err
+}
+
+const inviteDelete = `-- name: InviteDelete :exec
+DELETE FROM invites WHERE id=$1::uuid
+`
+
+func (q *Queries) InviteDelete(ctx context.Context, dollar_1 uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, inviteDelete, dollar_1)
+	return err
+}
+
+const inviteSetUsedBy = `-- name: InviteSetUsedBy :exec
+UPDATE invites SET used_by=$2::uuid WHERE id=$1::uuid
+`
+
+type InviteSetUsedByParams struct {
+	Column1 uuid.UUID `json:"column_1"`
+	Column2 uuid.UUID `json:"column_2"`
+}
+
+func (q *Queries) InviteSetUsedBy(ctx context.Context, arg InviteSetUsedByParams) error {
+	_, err := q.db.ExecContext(ctx, inviteSetUsedBy, arg.Column1, arg.Column2)
+	return err
+}
+
+const inviteUse = `-- name: InviteUse :one
+UPDATE invites SET used_at=now()
+WHERE code_hash=$1 AND used_at IS NULL AND (expires_at IS NULL OR expires_at > now())
+RETURNING id
+`
+
+func (q *Queries) InviteUse(ctx context.Context, codeHash string) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, inviteUse, codeHash)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const invitesList = `-- name: InvitesList :many
+SELECT id::text, note, COALESCE(created_by::text, '') AS created_by, expires_at, used_at,
+       COALESCE(used_by::text, '') AS used_by, created_at
+FROM invites ORDER BY created_at DESC
+`
+
+type InvitesListRow struct {
+	ID        string       `json:"id"`
+	Note      string       `json:"note"`
+	CreatedBy string       `json:"created_by"`
+	ExpiresAt sql.NullTime `json:"expires_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	UsedBy    string       `json:"used_by"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+func (q *Queries) InvitesList(ctx context.Context) ([]InvitesListRow, error) {
+	rows, err := q.db.QueryContext(ctx, invitesList)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []InvitesListRow
+	for rows.Next() {
+		var i InvitesListRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Note,
+			&i.CreatedBy,
+			&i.ExpiresAt,
+			&i.UsedAt,
+			&i.UsedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
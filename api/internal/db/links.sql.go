@@ -18,8 +18,9 @@ SELECT
   COALESCE(l.id_dest::text, '')   AS edge_to,
   l.tag
 FROM pages p
-LEFT JOIN page_links l ON l.id_source=p.id OR l.id_dest=p.id
-WHERE p.user_id=$1::uuid
+LEFT JOIN page_links l ON (l.id_source=p.id OR l.id_dest=p.id)
+  AND NOT EXISTS (SELECT 1 FROM pages t WHERE t.id IN (l.id_source, l.id_dest) AND t.deleted_at IS NOT NULL)
+WHERE p.user_id=$1::uuid AND p.deleted_at IS NULL
 `
 
 type GraphByUserRow struct {
@@ -60,7 +61,7 @@ func (q *Queries) GraphByUser(ctx context.Context, dollar_1 uuid.UUID) ([]GraphB
 }
 
 const linkCreate = `-- name: LinkCreate :one
-INSERT INTO page_links (id_source,id_dest,tag) VALUES ($1::uuid,$2::uuid, NULLIF($3,''))
+INSERT INTO page_links (id_source,id_dest,tag,anchor) VALUES ($1::uuid,$2::uuid, NULLIF($3,''), NULLIF($4,''))
 RETURNING id::text
 `
 
@@ -68,15 +69,43 @@ type LinkCreateParams struct {
 	Column1 uuid.UUID   `json:"column_1"`
 	Column2 uuid.UUID   `json:"column_2"`
 	Column3 interface{} `json:"column_3"`
+	Column4 interface{} `json:"column_4"`
 }
 
 func (q *Queries) LinkCreate(ctx context.Context, arg LinkCreateParams) (string, error) {
-	row := q.db.QueryRowContext(ctx, linkCreate, arg.Column1, arg.Column2, arg.Column3)
+	row := q.db.QueryRowContext(ctx, linkCreate,
+		arg.Column1,
+		arg.Column2,
+		arg.Column3,
+		arg.Column4,
+	)
 	var id string
 	err := row.Scan(&id)
 	return id, err
 }
 
+const linkCreateParsed = `-- name: LinkCreateParsed :exec
+INSERT INTO page_links (id_source,id_dest,anchor,tag,origin) VALUES ($1::uuid,$2::uuid, NULLIF($3,''), NULLIF($4,''),'parsed')
+ON CONFLICT (id_source,id_dest,(COALESCE(anchor,'')),(COALESCE(tag,''))) DO NOTHING
+`
+
+type LinkCreateParsedParams struct {
+	Column1 uuid.UUID   `json:"column_1"`
+	Column2 uuid.UUID   `json:"column_2"`
+	Column3 interface{} `json:"column_3"`
+	Column4 interface{} `json:"column_4"`
+}
+
+func (q *Queries) LinkCreateParsed(ctx context.Context, arg LinkCreateParsedParams) error {
+	_, err := q.db.ExecContext(ctx, linkCreateParsed,
+		arg.Column1,
+		arg.Column2,
+		arg.Column3,
+		arg.Column4,
+	)
+	return err
+}
+
 const linkDelete = `-- name: LinkDelete :exec
 DELETE FROM page_links WHERE id=$1::uuid
 `
@@ -87,7 +116,9 @@ func (q *Queries) LinkDelete(ctx context.Context, dollar_1 uuid.UUID) error {
 }
 
 const linksBySource = `-- name: LinksBySource :many
-SELECT id::text, id_source::text, id_dest::text, tag FROM page_links WHERE id_source=$1::uuid
+SELECT l.id::text, l.id_source::text, l.id_dest::text, l.tag, l.origin, l.anchor FROM page_links l
+JOIN pages d ON d.id=l.id_dest
+WHERE l.id_source=$1::uuid AND d.deleted_at IS NULL
 `
 
 type LinksBySourceRow struct {
@@ -95,6 +126,8 @@ type LinksBySourceRow struct {
 	IDSource string         `json:"id_source"`
 	IDDest   string         `json:"id_dest"`
 	Tag      sql.NullString `json:"tag"`
+	Origin   LinkOrigin     `json:"origin"`
+	Anchor   sql.NullString `json:"anchor"`
 }
 
 func (q *Queries) LinksBySource(ctx context.Context, dollar_1 uuid.UUID) ([]LinksBySourceRow, error) {
@@ -111,6 +144,8 @@ func (q *Queries) LinksBySource(ctx context.Context, dollar_1 uuid.UUID) ([]Link
 			&i.IDSource,
 			&i.IDDest,
 			&i.Tag,
+			&i.Origin,
+			&i.Anchor,
 		); err != nil {
 			return nil, err
 		}
@@ -125,11 +160,41 @@ func (q *Queries) LinksBySource(ctx context.Context, dollar_1 uuid.UUID) ([]Link
 	return items, nil
 }
 
-const linksDeleteBySource = `-- name: LinksDeleteBySource :exec
-DELETE FROM page_links WHERE id_source=$1::uuid
+const linksParsedBySource = `-- name: LinksParsedBySource :many
+SELECT id::text, id_dest::text, COALESCE(anchor,'') AS anchor, COALESCE(tag,'') AS tag FROM page_links WHERE id_source=$1::uuid AND origin='parsed'
 `
 
-func (q *Queries) LinksDeleteBySource(ctx context.Context, dollar_1 uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, linksDeleteBySource, dollar_1)
-	return err
+type LinksParsedBySourceRow struct {
+	ID     string `json:"id"`
+	IDDest string `json:"id_dest"`
+	Anchor string `json:"anchor"`
+	Tag    string `json:"tag"`
+}
+
+func (q *Queries) LinksParsedBySource(ctx context.Context, dollar_1 uuid.UUID) ([]LinksParsedBySourceRow, error) {
+	rows, err := q.db.QueryContext(ctx, linksParsedBySource, dollar_1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []LinksParsedBySourceRow
+	for rows.Next() {
+		var i LinksParsedBySourceRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.IDDest,
+			&i.Anchor,
+			&i.Tag,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
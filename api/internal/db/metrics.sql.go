@@ -0,0 +1,35 @@
+package db
+
+import (
+	"context"
+)
+
+const contentTotals = `-- name: ContentTotals :one
+SELECT
+  (SELECT count(*) FROM users) AS users,
+  (SELECT count(*) FROM pages WHERE deleted_at IS NULL) AS pages,
+  (SELECT count(*) FROM pages WHERE deleted_at IS NOT NULL) AS trashed,
+  (SELECT count(*) FROM page_links) AS links,
+  (SELECT COALESCE(sum(size_bytes), 0)::bigint FROM images) AS image_bytes
+`
+
+type ContentTotalsRow struct {
+	Users      int64 `json:"users"`
+	Pages      int64 `json:"pages"`
+	Trashed    int64 `json:"trashed"`
+	Links      int64 `json:"links"`
+	ImageBytes int64 `json:"image_bytes"`
+}
+
+func (q *Queries) ContentTotals(ctx context.Context) (ContentTotalsRow, error) {
+	row := q.db.QueryRowContext(ctx, contentTotals)
+	var i ContentTotalsRow
+	err := row.Scan(
+		&i.Users,
+		&i.Pages,
+		&i.Trashed,
+		&i.Links,
+		&i.ImageBytes,
+	)
+	return i, err
+}
@@ -3,17 +3,105 @@ package db
 import (
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type LinkOrigin string
+
+const (
+	LinkOriginManual LinkOrigin = "manual"
+	LinkOriginParsed LinkOrigin = "parsed"
+)
+
+func (e *LinkOrigin) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = LinkOrigin(s)
+	case string:
+		*e = LinkOrigin(s)
+	default:
+		return fmt.Errorf("unsupported scan type for LinkOrigin: %T", src)
+	}
+	return nil
+}
+
+type NullLinkOrigin struct {
+	LinkOrigin LinkOrigin `json:"link_origin"`
+	Valid      bool       `json:"valid"` // Valid is true if LinkOrigin is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullLinkOrigin) Scan(value interface{}) error {
+	if value == nil {
+		ns.LinkOrigin, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.LinkOrigin.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullLinkOrigin) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.LinkOrigin), nil
+}
+
+type TokenScope string
+
+const (
+	TokenScopeRead  TokenScope = "read"
+	TokenScopeWrite TokenScope = "write"
+)
+
+func (e *TokenScope) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = TokenScope(s)
+	case string:
+		*e = TokenScope(s)
+	default:
+		return fmt.Errorf("unsupported scan type for TokenScope: %T", src)
+	}
+	return nil
+}
+
+type NullTokenScope struct {
+	TokenScope TokenScope `json:"token_scope"`
+	Valid      bool       `json:"valid"` // Valid is true if TokenScope is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullTokenScope) Scan(value interface{}) error {
+	if value == nil {
+		ns.TokenScope, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.TokenScope.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullTokenScope) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.TokenScope), nil
+}
+
 type UserRole string
 
 const (
-	UserRoleUser UserRole = "user"
-	UserRoleAdm  UserRole = "adm"
+	UserRoleUser      UserRole = "user"
+	UserRoleAdm       UserRole = "adm"
+	UserRoleViewer    UserRole = "viewer"
+	UserRoleModerator UserRole = "moderator"
+	UserRoleAuditor   UserRole = "auditor"
 )
 
 func (e *UserRole) Scan(src interface{}) error {
@@ -51,7 +139,18 @@ func (ns NullUserRole) Value() (driver.Value, error) {
 	return string(ns.UserRole), nil
 }
 
-type Image struct {
+type AccessToken struct {
+	ID         uuid.UUID    `json:"id"`
+	UserID     uuid.UUID    `json:"user_id"`
+	Name       string       `json:"name"`
+	TokenHash  string       `json:"token_hash"`
+	Scope      TokenScope   `json:"scope"`
+	ExpiresAt  sql.NullTime `json:"expires_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+type ArchivedImage struct {
 	ID        uuid.UUID `json:"id"`
 	PageID    uuid.UUID `json:"page_id"`
 	Name      string    `json:"name"`
@@ -61,13 +160,70 @@ type Image struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
-type Page struct {
+type ArchivedPage struct {
+	ID         uuid.UUID       `json:"id"`
+	OwnerID    uuid.UUID       `json:"owner_id"`
+	OwnerEmail string          `json:"owner_email"`
+	Name       string          `json:"name"`
+	Body       string          `json:"body"`
+	Links      json.RawMessage `json:"links"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+	ArchivedAt time.Time       `json:"archived_at"`
+}
+
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	At         time.Time       `json:"at"`
+	ActorID    uuid.NullUUID   `json:"actor_id"`
+	ActorEmail string          `json:"actor_email"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	RequestID  string          `json:"request_id"`
+	Ip         string          `json:"ip"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+}
+
+type EmailVerification struct {
+	ID        uuid.UUID    `json:"id"`
+	UserID    uuid.UUID    `json:"user_id"`
+	TokenHash string       `json:"token_hash"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type Image struct {
 	ID        uuid.UUID `json:"id"`
-	UserID    uuid.UUID `json:"user_id"`
+	PageID    uuid.UUID `json:"page_id"`
 	Name      string    `json:"name"`
-	Body      string    `json:"body"`
+	Mime      string    `json:"mime"`
+	SizeBytes int32     `json:"size_bytes"`
+	Content   []byte    `json:"content"`
 	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type Invite struct {
+	ID        uuid.UUID     `json:"id"`
+	CodeHash  string        `json:"code_hash"`
+	Note      string        `json:"note"`
+	CreatedBy uuid.NullUUID `json:"created_by"`
+	ExpiresAt sql.NullTime  `json:"expires_at"`
+	UsedAt    sql.NullTime  `json:"used_at"`
+	UsedBy    uuid.NullUUID `json:"used_by"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+type Page struct {
+	ID        uuid.UUID    `json:"id"`
+	UserID    uuid.UUID    `json:"user_id"`
+	Name      string       `json:"name"`
+	Body      string       `json:"body"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	DeletedAt sql.NullTime `json:"deleted_at"`
 }
 
 type PageLink struct {
@@ -75,12 +231,48 @@ type PageLink struct {
 	IDSource uuid.UUID      `json:"id_source"`
 	IDDest   uuid.UUID      `json:"id_dest"`
 	Tag      sql.NullString `json:"tag"`
+	Origin   LinkOrigin     `json:"origin"`
+	Anchor   sql.NullString `json:"anchor"`
+}
+
+type PageTag struct {
+	PageID uuid.UUID `json:"page_id"`
+	Tag    string    `json:"tag"`
+}
+
+type PasswordReset struct {
+	ID        uuid.UUID    `json:"id"`
+	UserID    uuid.UUID    `json:"user_id"`
+	TokenHash string       `json:"token_hash"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type RecoveryCode struct {
+	ID       uuid.UUID    `json:"id"`
+	UserID   uuid.UUID    `json:"user_id"`
+	CodeHash string       `json:"code_hash"`
+	UsedAt   sql.NullTime `json:"used_at"`
+}
+
+type Setting struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
 }
 
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	Email        string    `json:"email"`
-	PassHash     string    `json:"pass_hash"`
-	Role         UserRole  `json:"role"`
-	JwtRevokedAt time.Time `json:"jwt_revoked_at"`
+	ID              uuid.UUID      `json:"id"`
+	Email           string         `json:"email"`
+	PassHash        string         `json:"pass_hash"`
+	Role            UserRole       `json:"role"`
+	JwtRevokedAt    time.Time      `json:"jwt_revoked_at"`
+	EmailVerifiedAt sql.NullTime   `json:"email_verified_at"`
+	FailedLogins    int32          `json:"failed_logins"`
+	LockedUntil     sql.NullTime   `json:"locked_until"`
+	TotpSecret      sql.NullString `json:"totp_secret"`
+	TotpEnabledAt   sql.NullTime   `json:"totp_enabled_at"`
+	TotpLastStep    int64          `json:"totp_last_step"`
+	DisabledAt      sql.NullTime   `json:"disabled_at"`
+	LastLoginAt     sql.NullTime   `json:"last_login_at"`
 }
@@ -2,13 +2,14 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 const pageByID = `-- name: PageByID :one
-SELECT id::text, user_id::text AS owner_id, name, body, updated_at FROM pages WHERE id=$1::uuid
+SELECT id::text, user_id::text AS owner_id, name, body, updated_at FROM pages WHERE id=$1::uuid AND deleted_at IS NULL
 `
 
 type PageByIDRow struct {
@@ -33,7 +34,7 @@ func (q *Queries) PageByID(ctx context.Context, dollar_1 uuid.UUID) (PageByIDRow
 }
 
 const pageByNameAndUser = `-- name: PageByNameAndUser :one
-SELECT id::text FROM pages WHERE user_id=$1::uuid AND name=$2 LIMIT 1
+SELECT id::text FROM pages WHERE user_id=$1::uuid AND name=$2 AND deleted_at IS NULL LIMIT 1
 `
 
 type PageByNameAndUserParams struct {
@@ -76,7 +77,7 @@ func (q *Queries) PageDelete(ctx context.Context, dollar_1 uuid.UUID) error {
 }
 
 const pageOwner = `-- name: PageOwner :one
-SELECT user_id::text FROM pages WHERE id=$1::uuid
+SELECT user_id::text FROM pages WHERE id=$1::uuid AND deleted_at IS NULL
 `
 
 func (q *Queries) PageOwner(ctx context.Context, dollar_1 uuid.UUID) (string, error) {
@@ -86,6 +87,15 @@ func (q *Queries) PageOwner(ctx context.Context, dollar_1 uuid.UUID) (string, er
 	return user_id, err
 }
 
+const pageRestore = `-- name: PageRestore :exec
+UPDATE pages SET deleted_at=NULL WHERE id=$1::uuid
+`
+
+func (q *Queries) PageRestore(ctx context.Context, dollar_1 uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, pageRestore, dollar_1)
+	return err
+}
+
 const pageSetOwner = `-- name: PageSetOwner :exec
 UPDATE pages SET user_id=$2::uuid WHERE id=$1::uuid
 `
@@ -100,8 +110,37 @@ func (q *Queries) PageSetOwner(ctx context.Context, arg PageSetOwnerParams) erro
 	return err
 }
 
+const pageTrash = `-- name: PageTrash :execrows
+UPDATE pages SET deleted_at=now() WHERE id=$1::uuid AND deleted_at IS NULL
+`
+
+func (q *Queries) PageTrash(ctx context.Context, dollar_1 uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, pageTrash, dollar_1)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const pageTrashedByID = `-- name: PageTrashedByID :one
+SELECT user_id, name, body FROM pages WHERE id=$1::uuid AND deleted_at IS NOT NULL
+`
+
+type PageTrashedByIDRow struct {
+	UserID uuid.UUID `json:"user_id"`
+	Name   string    `json:"name"`
+	Body   string    `json:"body"`
+}
+
+func (q *Queries) PageTrashedByID(ctx context.Context, dollar_1 uuid.UUID) (PageTrashedByIDRow, error) {
+	row := q.db.QueryRowContext(ctx, pageTrashedByID, dollar_1)
+	var i PageTrashedByIDRow
+	err := row.Scan(&i.UserID, &i.Name, &i.Body)
+	return i, err
+}
+
 const pageUpdate = `-- name: PageUpdate :exec
-UPDATE pages SET name=$2, body=$3 WHERE id=$1::uuid
+UPDATE pages SET name=$2, body=$3 WHERE id=$1::uuid AND deleted_at IS NULL
 `
 
 type PageUpdateParams struct {
@@ -118,6 +157,7 @@ func (q *Queries) PageUpdate(ctx context.Context, arg PageUpdateParams) error {
 const pagesAll = `-- name: PagesAll :many
 SELECT p.id::text AS id, p.name, u.email AS owner_email, p.updated_at
 FROM pages p JOIN users u ON u.id=p.user_id
+WHERE p.deleted_at IS NULL
 ORDER BY p.updated_at DESC
 `
 
@@ -157,7 +197,7 @@ func (q *Queries) PagesAll(ctx context.Context) ([]PagesAllRow, error) {
 }
 
 const pagesByUser = `-- name: PagesByUser :many
-SELECT id::text, name, updated_at FROM pages WHERE user_id=$1::uuid ORDER BY updated_at DESC
+SELECT id::text, name, updated_at FROM pages WHERE user_id=$1::uuid AND deleted_at IS NULL ORDER BY updated_at DESC
 `
 
 type PagesByUserRow struct {
@@ -189,9 +229,150 @@ func (q *Queries) PagesByUser(ctx context.Context, dollar_1 uuid.UUID) ([]PagesB
 	return items, nil
 }
 
+const pagesContentByUser = `-- name: PagesContentByUser :many
+SELECT id, name, body FROM pages WHERE user_id=$1::uuid AND deleted_at IS NULL ORDER BY created_at
+`
+
+type PagesContentByUserRow struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	Body string    `json:"body"`
+}
+
+func (q *Queries) PagesContentByUser(ctx context.Context, dollar_1 uuid.UUID) ([]PagesContentByUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, pagesContentByUser, dollar_1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PagesContentByUserRow
+	for rows.Next() {
+		var i PagesContentByUserRow
+		if err := rows.Scan(&i.ID, &i.Name, &i.Body); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const pagesDeleteByUser = `-- name: PagesDeleteByUser :exec
+DELETE FROM pages WHERE user_id=$1::uuid
+`
+
+func (q *Queries) PagesDeleteByUser(ctx context.Context, dollar_1 uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, pagesDeleteByUser, dollar_1)
+	return err
+}
+
+const pagesMentioning = `-- name: PagesMentioning :many
+SELECT id, body FROM pages
+WHERE user_id=$1::uuid AND deleted_at IS NULL AND id<>$2::uuid AND strpos(body, $3::text) > 0
+`
+
+type PagesMentioningParams struct {
+	Column1 uuid.UUID `json:"column_1"`
+	Column2 uuid.UUID `json:"column_2"`
+	Column3 string    `json:"column_3"`
+}
+
+type PagesMentioningRow struct {
+	ID   uuid.UUID `json:"id"`
+	Body string    `json:"body"`
+}
+
+func (q *Queries) PagesMentioning(ctx context.Context, arg PagesMentioningParams) ([]PagesMentioningRow, error) {
+	rows, err := q.db.QueryContext(ctx, pagesMentioning, arg.Column1, arg.Column2, arg.Column3)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PagesMentioningRow
+	for rows.Next() {
+		var i PagesMentioningRow
+		if err := rows.Scan(&i.ID, &i.Body); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const pagesPurgeTrashByUser = `-- name: PagesPurgeTrashByUser :execrows
+DELETE FROM pages WHERE user_id=$1::uuid AND deleted_at IS NOT NULL
+`
+
+func (q *Queries) PagesPurgeTrashByUser(ctx context.Context, dollar_1 uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, pagesPurgeTrashByUser, dollar_1)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const pagesPurgeTrashed = `-- name: PagesPurgeTrashed :execrows
+DELETE FROM pages WHERE deleted_at < $1::timestamptz
+`
+
+func (q *Queries) PagesPurgeTrashed(ctx context.Context, dollar_1 time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, pagesPurgeTrashed, dollar_1)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const pagesTrashByUser = `-- name: PagesTrashByUser :many
+SELECT id::text, name, deleted_at FROM pages
+WHERE user_id=$1::uuid AND deleted_at IS NOT NULL
+ORDER BY deleted_at DESC
+`
+
+type PagesTrashByUserRow struct {
+	ID        string       `json:"id"`
+	Name      string       `json:"name"`
+	DeletedAt sql.NullTime `json:"deleted_at"`
+}
+
+func (q *Queries) PagesTrashByUser(ctx context.Context, dollar_1 uuid.UUID) ([]PagesTrashByUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, pagesTrashByUser, dollar_1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PagesTrashByUserRow
+	for rows.Next() {
+		var i PagesTrashByUserRow
+		if err := rows.Scan(&i.ID, &i.Name, &i.DeletedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const pagesWithOwners = `-- name: PagesWithOwners :many
 SELECT p.id::text AS id, p.name, u.id::text AS owner_id, u.email AS owner_email, p.updated_at
 FROM pages p JOIN users u ON u.id=p.user_id
+WHERE p.deleted_at IS NULL
 ORDER BY p.updated_at DESC
 `
 
@@ -231,3 +412,36 @@ func (q *Queries) PagesWithOwners(ctx context.Context) ([]PagesWithOwnersRow, er
 	}
 	return items, nil
 }
+
+const userContentCounts = `-- name: UserContentCounts :one
+SELECT
+  (SELECT count(*) FROM pages p WHERE p.user_id=$1::uuid AND p.deleted_at IS NULL) AS pages,
+  (SELECT count(*) FROM pages p WHERE p.user_id=$1::uuid AND p.deleted_at IS NOT NULL) AS trashed,
+  (SELECT count(*) FROM page_links l JOIN pages p ON p.id=l.id_source WHERE p.user_id=$1::uuid) AS links,
+  (SELECT count(*) FROM images i JOIN pages p ON p.id=i.page_id WHERE p.user_id=$1::uuid) AS images,
+  (SELECT count(*) FROM page_links l
+     JOIN pages d ON d.id=l.id_dest
+     JOIN pages s ON s.id=l.id_source
+   WHERE d.user_id=$1::uuid AND s.user_id<>$1::uuid) AS incoming_links
+`
+
+type UserContentCountsRow struct {
+	Pages         int64 `json:"pages"`
+	Trashed       int64 `json:"trashed"`
+	Links         int64 `json:"links"`
+	Images        int64 `json:"images"`
+	IncomingLinks int64 `json:"incoming_links"`
+}
+
+func (q *Queries) UserContentCounts(ctx context.Context, dollar_1 uuid.UUID) (UserContentCountsRow, error) {
+	row := q.db.QueryRowContext(ctx, userContentCounts, dollar_1)
+	var i UserContentCountsRow
+	err := row.Scan(
+		&i.Pages,
+		&i.Trashed,
+		&i.Links,
+		&i.Images,
+		&i.IncomingLinks,
+	)
+	return i, err
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const recoveryCodeCreate = `-- name: RecoveryCodeCreate :exec
+INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1::uuid, $2)
+`
+
+type RecoveryCodeCreateParams struct {
+	Column1  uuid.UUID `json:"column_1"`
+	CodeHash string    `json:"code_hash"`
+}
+
+func (q *Queries) RecoveryCodeCreate(ctx context.Context, arg RecoveryCodeCreateParams) error {
+	_, err := q.db.ExecContext(ctx, recoveryCodeCreate, arg.Column1, arg.CodeHash)
+	return err
+}
+
+const recoveryCodeUse = `-- name: RecoveryCodeUse :execrows
+UPDATE recovery_codes SET used_at=now()
+WHERE user_id=$1::uuid AND code_hash=$2 AND used_at IS NULL
+`
+
+type RecoveryCodeUseParams struct {
+	Column1  uuid.UUID `json:"column_1"`
+	CodeHash string    `json:"code_hash"`
+}
+
+func (q *Queries) RecoveryCodeUse(ctx context.Context, arg RecoveryCodeUseParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, recoveryCodeUse, arg.Column1, arg.CodeHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const recoveryCodesDeleteByUser = `-- name: RecoveryCodesDeleteByUser :exec
+DELETE FROM recovery_codes WHERE user_id=$1::uuid
+`
+
+func (q *Queries) RecoveryCodesDeleteByUser(ctx context.Context, dollar_1 uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, recoveryCodesDeleteByUser, dollar_1)
+	return err
+}
+
+const recoveryCodesLeft = `-- name: RecoveryCodesLeft :one
+SELECT count(*) FROM recovery_codes WHERE user_id=$1::uuid AND used_at IS NULL
+`
+
+func (q *Queries) RecoveryCodesLeft(ctx context.Context, dollar_1 uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, recoveryCodesLeft, dollar_1)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const resetCreate = `-- name: ResetCreate :exec
+INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES ($1::uuid, $2, $3)
+`
+
+type ResetCreateParams struct {
+	Column1   uuid.UUID `json:"column_1"`
+	TokenHash string    `json:"token_hash"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (q *Queries) ResetCreate(ctx context.Context, arg ResetCreateParams) error {
+	_, err := q.db.ExecContext(ctx, resetCreate, arg.Column1, arg.TokenHash, arg.ExpiresAt)
+	return err
+}
+
+const resetPeek = `-- name: ResetPeek :one
+SELECT user_id FROM password_resets
+WHERE token_hash=$1 AND used_at IS NULL AND expires_at > now()
+`
+
+func (q *Queries) ResetPeek(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, resetPeek, tokenHash)
+	var user_id uuid.UUID
+	err := row.Scan(&user_id)
+	return user_id, err
+}
+
+const resetUse = `-- name: ResetUse :one
+UPDATE password_resets SET used_at=now()
+WHERE token_hash=$1 AND used_at IS NULL AND expires_at > now()
+RETURNING user_id
+`
+
+func (q *Queries) ResetUse(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, resetUse, tokenHash)
+	var user_id uuid.UUID
+	err := row.Scan(&user_id)
+	return user_id, err
+}
+
+const resetsDeleteByUser = `-- name: ResetsDeleteByUser :exec
+DELETE FROM password_resets WHERE user_id=$1::uuid AND used_at IS NULL
+`
+
+func (q *Queries) ResetsDeleteByUser(ctx context.Context, dollar_1 uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, resetsDeleteByUser, dollar_1)
+	return err
+}
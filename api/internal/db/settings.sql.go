@@ -0,0 +1,31 @@
+package db
+
+import (
+	"context"
+)
+
+const settingGet = `-- name: SettingGet :one
+SELECT value FROM settings WHERE key=$1
+`
+
+func (q *Queries) SettingGet(ctx context.Context, key string) (string, error) {
+	row := q.db.QueryRowContext(ctx, settingGet, key)
+	var value string
+	err := row.Scan(&value)
+	return value, err
+}
+
+const settingSet = `-- name: SettingSet :exec
+INSERT INTO settings (key, value) VALUES ($1, $2)
+ON CONFLICT (key) DO UPDATE SET value=EXCLUDED.value
+`
+
+type SettingSetParams struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func (q *Queries) SettingSet(ctx context.Context, arg SettingSetParams) error {
+	_, err := q.db.ExecContext(ctx, settingSet, arg.Key, arg.Value)
+	return err
+}
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const graphTagsByUser = `-- name: GraphTagsByUser :many
+SELECT t.page_id::text, t.tag
+FROM page_tags t JOIN pages p ON p.id=t.page_id
+WHERE p.user_id=$1::uuid AND p.deleted_at IS NULL
+`
+
+type GraphTagsByUserRow struct {
+	PageID string `json:"page_id"`
+	Tag    string `json:"tag"`
+}
+
+func (q *Queries) GraphTagsByUser(ctx context.Context, dollar_1 uuid.UUID) ([]GraphTagsByUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, graphTagsByUser, dollar_1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GraphTagsByUserRow
+	for rows.Next() {
+		var i GraphTagsByUserRow
+		if err := rows.Scan(&i.PageID, &i.Tag); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const pagesByTag = `-- name: PagesByTag :many
+SELECT DISTINCT p.id::text, p.name, p.body, p.updated_at
+FROM pages p JOIN page_tags t ON t.page_id=p.id
+WHERE p.user_id=$1::uuid AND p.deleted_at IS NULL AND (t.tag=$2::text OR starts_with(t.tag, $2::text || '/'))
+ORDER BY p.updated_at DESC
+`
+
+type PagesByTagParams struct {
+	Column1 uuid.UUID `json:"column_1"`
+	Column2 string    `json:"column_2"`
+}
+
+type PagesByTagRow struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Body      string    `json:"body"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (q *Queries) PagesByTag(ctx context.Context, arg PagesByTagParams) ([]PagesByTagRow, error) {
+	rows, err := q.db.QueryContext(ctx, pagesByTag, arg.Column1, arg.Column2)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PagesByTagRow
+	for rows.Next() {
+		var i PagesByTagRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Body,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const tagAdd = `-- name: TagAdd :exec
+INSERT INTO page_tags (page_id, tag) VALUES ($1::uuid, $2)
+ON CONFLICT DO NOTHING
+`
+
+type TagAddParams struct {
+	Column1 uuid.UUID `json:"column_1"`
+	Tag     string    `json:"tag"`
+}
+
+func (q *Queries) TagAdd(ctx context.Context, arg TagAddParams) error {
+	_, err := q.db.ExecContext(ctx, tagAdd, arg.Column1, arg.Tag)
+	return err
+}
+
+const tagDelete = `-- name: TagDelete :exec
+DELETE FROM page_tags WHERE page_id=$1::uuid AND tag=$2
+`
+
+type TagDeleteParams struct {
+	Column1 uuid.UUID `json:"column_1"`
+	Tag     string    `json:"tag"`
+}
+
+func (q *Queries) TagDelete(ctx context.Context, arg TagDeleteParams) error {
+	_, err := q.db.ExecContext(ctx, tagDelete, arg.Column1, arg.Tag)
+	return err
+}
+
+const tagIndexPages = `-- name: TagIndexPages :many
+SELECT id, body FROM pages
+`
+
+type TagIndexPagesRow struct {
+	ID   uuid.UUID `json:"id"`
+	Body string    `json:"body"`
+}
+
+func (q *Queries) TagIndexPages(ctx context.Context) ([]TagIndexPagesRow, error) {
+	rows, err := q.db.QueryContext(ctx, tagIndexPages)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TagIndexPagesRow
+	for rows.Next() {
+		var i TagIndexPagesRow
+		if err := rows.Scan(&i.ID, &i.Body); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const tagsByPage = `-- name: TagsByPage :many
+SELECT tag FROM page_tags WHERE page_id=$1::uuid
+`
+
+func (q *Queries) TagsByPage(ctx context.Context, dollar_1 uuid.UUID) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, tagsByPage, dollar_1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		items = append(items, tag)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const tagsByUser = `-- name: TagsByUser :many
+SELECT t.tag, count(*) AS pages
+FROM page_tags t JOIN pages p ON p.id=t.page_id
+WHERE p.user_id=$1::uuid AND p.deleted_at IS NULL
+GROUP BY t.tag
+ORDER BY t.tag
+`
+
+type TagsByUserRow struct {
+	Tag   string `json:"tag"`
+	Pages int64  `json:"pages"`
+}
+
+func (q *Queries) TagsByUser(ctx context.Context, dollar_1 uuid.UUID) ([]TagsByUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, tagsByUser, dollar_1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TagsByUserRow
+	for rows.Next() {
+		var i TagsByUserRow
+		if err := rows.Scan(&i.Tag, &i.Pages); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
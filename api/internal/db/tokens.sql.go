@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const accessTokenCreate = `-- name: AccessTokenCreate :one
+INSERT INTO access_tokens (user_id, name, token_hash, scope, expires_at)
+VALUES ($1::uuid, $2, $3, $4, $5)
+RETURNING id::text
+`
+
+type AccessTokenCreateParams struct {
+	Column1   uuid.UUID    `json:"column_1"`
+	Name      string       `json:"name"`
+	TokenHash string       `json:"token_hash"`
+	Scope     TokenScope   `json:"scope"`
+	ExpiresAt sql.NullTime `json:"expires_at"`
+}
+
+func (q *Queries) AccessTokenCreate(ctx context.Context, arg AccessTokenCreateParams) (string, error) {
+	row := q.db.QueryRowContext(ctx, accessTokenCreate,
+		arg.Column1,
+		arg.Name,
+		arg.TokenHash,
+		arg.Scope,
+		arg.ExpiresAt,
+	)
+	var id string
+	err := row.Scan(&id)
+	return id, err
+}
+
+const accessTokenDelete = `-- name: AccessTokenDelete :execrows
+DELETE FROM access_tokens WHERE id=$1::uuid AND user_id=$2::uuid
+`
+
+type AccessTokenDeleteParams struct {
+	Column1 uuid.UUID `json:"column_1"`
+	Column2 uuid.UUID `json:"column_2"`
+}
+
+func (q *Queries) AccessTokenDelete(ctx context.Context, arg AccessTokenDeleteParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, accessTokenDelete, arg.Column1, arg.Column2)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const accessTokenLookup = `-- name: AccessTokenLookup :one
+SELECT t.id, t.user_id::text, u.role, t.scope
+FROM access_tokens t JOIN users u ON u.id=t.user_id
+WHERE t.token_hash=$1 AND (t.expires_at IS NULL OR t.expires_at > now())
+  AND u.disabled_at IS NULL AND t.created_at > u.jwt_revoked_at
+`
+
+type AccessTokenLookupRow struct {
+	ID     uuid.UUID  `json:"id"`
+	UserID string     `json:"user_id"`
+	Role   UserRole   `json:"role"`
+	Scope  TokenScope `json:"scope"`
+}
+
+func (q *Queries) AccessTokenLookup(ctx context.Context, tokenHash string) (AccessTokenLookupRow, error) {
+	row := q.db.QueryRowContext(ctx, accessTokenLookup, tokenHash)
+	var i AccessTokenLookupRow
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Role,
+		&i.Scope,
+	)
+	return i, err
+}
+
+const accessTokenTouch = `-- name: AccessTokenTouch :exec
+UPDATE access_tokens SET last_used_at=now()
+WHERE id=$1 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute')
+`
+
+func (q *Queries) AccessTokenTouch(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, accessTokenTouch, id)
+	return err
+}
+
+const accessTokensByUser = `-- name: AccessTokensByUser :many
+SELECT id::text, name, scope, expires_at, last_used_at, created_at
+FROM access_tokens WHERE user_id=$1::uuid ORDER BY created_at DESC
+`
+
+type AccessTokensByUserRow struct {
+	ID         string       `json:"id"`
+	Name       string       `json:"name"`
+	Scope      TokenScope   `json:"scope"`
+	ExpiresAt  sql.NullTime `json:"expires_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+func (q *Queries) AccessTokensByUser(ctx context.Context, dollar_1 uuid.UUID) ([]AccessTokensByUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, accessTokensByUser, dollar_1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AccessTokensByUserRow
+	for rows.Next() {
+		var i AccessTokensByUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Scope,
+			&i.ExpiresAt,
+			&i.LastUsedAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const accessTokensDeleteByUser = `-- name: AccessTokensDeleteByUser :exec
+DELETE FROM access_tokens WHERE user_id=$1::uuid
+`
+
+func (q *Queries) AccessTokensDeleteByUser(ctx context.Context, dollar_1 uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, accessTokensDeleteByUser, dollar_1)
+	return err
+}
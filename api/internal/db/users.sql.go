@@ -2,55 +2,111 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-const adminSetPassword = `-- name: AdminSetPassword :exec
-UPDATE users SET pass_hash=$1 WHERE email='admin@local'
+const adminBootstrapPassword = `-- name: AdminBootstrapPassword :execrows
+UPDATE users SET pass_hash=$1 WHERE email='admin@local' AND pass_hash='__TO_BE_SET__'
 `
 
-func (q *Queries) AdminSetPassword(ctx context.Context, passHash string) error {
-	_, err := q.db.ExecContext(ctx, adminSetPassword, passHash)
-	return err
+func (q *Queries) AdminBootstrapPassword(ctx context.Context, passHash string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, adminBootstrapPassword, passHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const adminUserCreate = `-- name: AdminUserCreate :one
+INSERT INTO users (email, pass_hash, role, email_verified_at) VALUES ($1,$2,$3,now())
+RETURNING id::text
+`
+
+type AdminUserCreateParams struct {
+	Email    string   `json:"email"`
+	PassHash string   `json:"pass_hash"`
+	Role     UserRole `json:"role"`
+}
+
+func (q *Queries) AdminUserCreate(ctx context.Context, arg AdminUserCreateParams) (string, error) {
+	row := q.db.QueryRowContext(ctx, adminUserCreate, arg.Email, arg.PassHash, arg.Role)
+	var id string
+	err := row.Scan(&id)
+	return id, err
 }
 
 const userByEmail = `-- name: UserByEmail :one
-SELECT id, email, pass_hash, role FROM users WHERE email = $1
+SELECT id, email, pass_hash, role, email_verified_at, locked_until, totp_enabled_at, disabled_at FROM users WHERE lower(email) = lower($1)
 `
 
 type UserByEmailRow struct {
-	ID       uuid.UUID `json:"id"`
-	Email    string    `json:"email"`
-	PassHash string    `json:"pass_hash"`
-	Role     UserRole  `json:"role"`
+	ID              uuid.UUID    `json:"id"`
+	Email           string       `json:"email"`
+	PassHash        string       `json:"pass_hash"`
+	Role            UserRole     `json:"role"`
+	EmailVerifiedAt sql.NullTime `json:"email_verified_at"`
+	LockedUntil     sql.NullTime `json:"locked_until"`
+	TotpEnabledAt   sql.NullTime `json:"totp_enabled_at"`
+	DisabledAt      sql.NullTime `json:"disabled_at"`
 }
 
-func (q *Queries) UserByEmail(ctx context.Context, email string) (UserByEmailRow, error) {
-	row := q.db.QueryRowContext(ctx, userByEmail, email)
+func (q *Queries) UserByEmail(ctx context.Context, lower string) (UserByEmailRow, error) {
+	row := q.db.QueryRowContext(ctx, userByEmail, lower)
 	var i UserByEmailRow
 	err := row.Scan(
 		&i.ID,
 		&i.Email,
 		&i.PassHash,
 		&i.Role,
+		&i.EmailVerifiedAt,
+		&i.LockedUntil,
+		&i.TotpEnabledAt,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+const userByID = `-- name: UserByID :one
+SELECT id, email, pass_hash, role, jwt_revoked_at, email_verified_at, failed_logins, locked_until, totp_secret, totp_enabled_at, totp_last_step, disabled_at, last_login_at FROM users WHERE id=$1::uuid
+`
+
+func (q *Queries) UserByID(ctx context.Context, dollar_1 uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, userByID, dollar_1)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PassHash,
+		&i.Role,
+		&i.JwtRevokedAt,
+		&i.EmailVerifiedAt,
+		&i.FailedLogins,
+		&i.LockedUntil,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.DisabledAt,
+		&i.LastLoginAt,
 	)
 	return i, err
 }
 
 const userCreate = `-- name: UserCreate :one
-INSERT INTO users (email, pass_hash) VALUES ($1,$2)
+INSERT INTO users (email, pass_hash, email_verified_at) VALUES ($1,$2,$3)
 RETURNING id::text
 `
 
 type UserCreateParams struct {
-	Email    string `json:"email"`
-	PassHash string `json:"pass_hash"`
+	Email           string       `json:"email"`
+	PassHash        string       `json:"pass_hash"`
+	EmailVerifiedAt sql.NullTime `json:"email_verified_at"`
 }
 
 func (q *Queries) UserCreate(ctx context.Context, arg UserCreateParams) (string, error) {
-	row := q.db.QueryRowContext(ctx, userCreate, arg.Email, arg.PassHash)
+	row := q.db.QueryRowContext(ctx, userCreate, arg.Email, arg.PassHash, arg.EmailVerifiedAt)
 	var id string
 	err := row.Scan(&id)
 	return id, err
@@ -65,15 +121,209 @@ func (q *Queries) UserDelete(ctx context.Context, dollar_1 uuid.UUID) error {
 	return err
 }
 
+const userDisable = `-- name: UserDisable :exec
+UPDATE users SET disabled_at=now(), jwt_revoked_at=now() WHERE id=$1::uuid
+`
+
+func (q *Queries) UserDisable(ctx context.Context, dollar_1 uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, userDisable, dollar_1)
+	return err
+}
+
+const userEnable = `-- name: UserEnable :exec
+UPDATE users SET disabled_at=NULL WHERE id=$1::uuid
+`
+
+func (q *Queries) UserEnable(ctx context.Context, dollar_1 uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, userEnable, dollar_1)
+	return err
+}
+
+const userLoginFailed = `-- name: UserLoginFailed :one
+UPDATE users SET
+  failed_logins = CASE WHEN failed_logins + 1 >= $2::int THEN 0 ELSE failed_logins + 1 END,
+  locked_until = CASE WHEN failed_logins + 1 >= $2::int THEN $3::timestamptz ELSE locked_until END
+WHERE id=$1::uuid
+RETURNING locked_until
+`
+
+type UserLoginFailedParams struct {
+	Column1 uuid.UUID `json:"column_1"`
+	Column2 int32     `json:"column_2"`
+	Column3 time.Time `json:"column_3"`
+}
+
+func (q *Queries) UserLoginFailed(ctx context.Context, arg UserLoginFailedParams) (sql.NullTime, error) {
+	row := q.db.QueryRowContext(ctx, userLoginFailed, arg.Column1, arg.Column2, arg.Column3)
+	var locked_until sql.NullTime
+	err := row.Scan(&locked_until)
+	return locked_until, err
+}
+
+const userLoginSucceeded = `-- name: UserLoginSucceeded :exec
+UPDATE users SET failed_logins=0, locked_until=NULL, last_login_at=now() WHERE id=$1::uuid
+`
+
+func (q *Queries) UserLoginSucceeded(ctx context.Context, dollar_1 uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, userLoginSucceeded, dollar_1)
+	return err
+}
+
+const userRevokedAt = `-- name: UserRevokedAt :one
+SELECT jwt_revoked_at FROM users WHERE id=$1::uuid AND disabled_at IS NULL
+`
+
+func (q *Queries) UserRevokedAt(ctx context.Context, dollar_1 uuid.UUID) (time.Time, error) {
+	row := q.db.QueryRowContext(ctx, userRevokedAt, dollar_1)
+	var jwt_revoked_at time.Time
+	err := row.Scan(&jwt_revoked_at)
+	return jwt_revoked_at, err
+}
+
+const userSetEmail = `-- name: UserSetEmail :exec
+UPDATE users SET email=$2, email_verified_at=$3, jwt_revoked_at=now() WHERE id=$1::uuid
+`
+
+type UserSetEmailParams struct {
+	Column1         uuid.UUID    `json:"column_1"`
+	Email           string       `json:"email"`
+	EmailVerifiedAt sql.NullTime `json:"email_verified_at"`
+}
+
+func (q *Queries) UserSetEmail(ctx context.Context, arg UserSetEmailParams) error {
+	_, err := q.db.ExecContext(ctx, userSetEmail, arg.Column1, arg.Email, arg.EmailVerifiedAt)
+	return err
+}
+
+const userSetEmailVerified = `-- name: UserSetEmailVerified :exec
+UPDATE users SET email_verified_at=now() WHERE id=$1::uuid
+`
+
+func (q *Queries) UserSetEmailVerified(ctx context.Context, dollar_1 uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, userSetEmailVerified, dollar_1)
+	return err
+}
+
+const userSetRole = `-- name: UserSetRole :exec
+UPDATE users SET role=$2, jwt_revoked_at=now() WHERE id=$1::uuid
+`
+
+type UserSetRoleParams struct {
+	Column1 uuid.UUID `json:"column_1"`
+	Role    UserRole  `json:"role"`
+}
+
+func (q *Queries) UserSetRole(ctx context.Context, arg UserSetRoleParams) error {
+	_, err := q.db.ExecContext(ctx, userSetRole, arg.Column1, arg.Role)
+	return err
+}
+
+const userSetPassword = `-- name: UserSetPassword :exec
+UPDATE users SET pass_hash=$2, jwt_revoked_at=now() WHERE id=$1::uuid
+`
+
+type UserSetPasswordParams struct {
+	Column1  uuid.UUID `json:"column_1"`
+	PassHash string    `json:"pass_hash"`
+}
+
+func (q *Queries) UserSetPassword(ctx context.Context, arg UserSetPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, userSetPassword, arg.Column1, arg.PassHash)
+	return err
+}
+
+const userTotpDisable = `-- name: UserTotpDisable :exec
+UPDATE users SET totp_secret=NULL, totp_enabled_at=NULL, totp_last_step=0 WHERE id=$1::uuid
+`
+
+func (q *Queries) UserTotpDisable(ctx context.Context, dollar_1 uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, userTotpDisable, dollar_1)
+	return err
+}
+
+const userTotpEnable = `-- name: UserTotpEnable :exec
+UPDATE users SET totp_enabled_at=now(), totp_last_step=$2, jwt_revoked_at=now() WHERE id=$1::uuid
+`
+
+type UserTotpEnableParams struct {
+	Column1      uuid.UUID `json:"column_1"`
+	TotpLastStep int64     `json:"totp_last_step"`
+}
+
+func (q *Queries) UserTotpEnable(ctx context.Context, arg UserTotpEnableParams) error {
+	_, err := q.db.ExecContext(ctx, userTotpEnable, arg.Column1, arg.TotpLastStep)
+	return err
+}
+
+const userTotpSetSecret = `-- name: UserTotpSetSecret :exec
+UPDATE users SET totp_secret=$2 WHERE id=$1::uuid AND totp_enabled_at IS NULL
+`
+
+type UserTotpSetSecretParams struct {
+	Column1    uuid.UUID      `json:"column_1"`
+	TotpSecret sql.NullString `json:"totp_secret"`
+}
+
+func (q *Queries) UserTotpSetSecret(ctx context.Context, arg UserTotpSetSecretParams) error {
+	_, err := q.db.ExecContext(ctx, userTotpSetSecret, arg.Column1, arg.TotpSecret)
+	return err
+}
+
+const userTotpUseStep = `-- name: UserTotpUseStep :execrows
+UPDATE users SET totp_last_step=$2 WHERE id=$1::uuid AND totp_last_step < $2
+`
+
+type UserTotpUseStepParams struct {
+	Column1      uuid.UUID `json:"column_1"`
+	TotpLastStep int64     `json:"totp_last_step"`
+}
+
+func (q *Queries) UserTotpUseStep(ctx context.Context, arg UserTotpUseStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, userTotpUseStep, arg.Column1, arg.TotpLastStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const userUnlock = `-- name: UserUnlock :exec
+UPDATE users SET failed_logins=0, locked_until=NULL WHERE id=$1::uuid
+`
+
+func (q *Queries) UserUnlock(ctx context.Context, dollar_1 uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, userUnlock, dollar_1)
+	return err
+}
+
+const usersCountByRole = `-- name: UsersCountByRole :one
+SELECT count(*) FROM users WHERE role=$1
+`
+
+func (q *Queries) UsersCountByRole(ctx context.Context, role UserRole) (int64, error) {
+	row := q.db.QueryRowContext(ctx, usersCountByRole, role)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const usersList = `-- name: UsersList :many
-SELECT id::text, email, role, jwt_revoked_at FROM users ORDER BY email
+SELECT u.id::text, u.email, u.role, u.jwt_revoked_at, u.disabled_at, u.last_login_at,
+  (SELECT count(*) FROM pages p WHERE p.user_id=u.id AND p.deleted_at IS NULL) AS pages,
+  (SELECT count(*) FROM page_links l JOIN pages p ON p.id=l.id_source WHERE p.user_id=u.id) AS links,
+  (SELECT count(*) FROM images i JOIN pages p ON p.id=i.page_id WHERE p.user_id=u.id) AS images
+FROM users u ORDER BY u.email
 `
 
 type UsersListRow struct {
-	ID           string    `json:"id"`
-	Email        string    `json:"email"`
-	Role         UserRole  `json:"role"`
-	JwtRevokedAt time.Time `json:"jwt_revoked_at"`
+	ID           string       `json:"id"`
+	Email        string       `json:"email"`
+	Role         UserRole     `json:"role"`
+	JwtRevokedAt time.Time    `json:"jwt_revoked_at"`
+	DisabledAt   sql.NullTime `json:"disabled_at"`
+	LastLoginAt  sql.NullTime `json:"last_login_at"`
+	Pages        int64        `json:"pages"`
+	Links        int64        `json:"links"`
+	Images       int64        `json:"images"`
 }
 
 func (q *Queries) UsersList(ctx context.Context) ([]UsersListRow, error) {
@@ -90,6 +340,11 @@ func (q *Queries) UsersList(ctx context.Context) ([]UsersListRow, error) {
 			&i.Email,
 			&i.Role,
 			&i.JwtRevokedAt,
+			&i.DisabledAt,
+			&i.LastLoginAt,
+			&i.Pages,
+			&i.Links,
+			&i.Images,
 		); err != nil {
 			return nil, err
 		}
@@ -103,3 +358,36 @@ func (q *Queries) UsersList(ctx context.Context) ([]UsersListRow, error) {
 	}
 	return items, nil
 }
+
+const usersLocked = `-- name: UsersLocked :many
+SELECT id::text, email, locked_until FROM users WHERE locked_until > now() ORDER BY locked_until DESC
+`
+
+type UsersLockedRow struct {
+	ID          string       `json:"id"`
+	Email       string       `json:"email"`
+	LockedUntil sql.NullTime `json:"locked_until"`
+}
+
+func (q *Queries) UsersLocked(ctx context.Context) ([]UsersLockedRow, error) {
+	rows, err := q.db.QueryContext(ctx, usersLocked)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UsersLockedRow
+	for rows.Next() {
+		var i UsersLockedRow
+		if err := rows.Scan(&i.ID, &i.Email, &i.LockedUntil); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
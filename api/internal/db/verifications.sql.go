@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const verificationCreate = `-- name: VerificationCreate :exec
+INSERT INTO email_verifications (user_id, token_hash, expires_at) VALUES ($1::uuid, $2, $3)
+`
+
+type VerificationCreateParams struct {
+	Column1   uuid.UUID `json:"column_1"`
+	TokenHash string    `json:"token_hash"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (q *Queries) VerificationCreate(ctx context.Context, arg VerificationCreateParams) error {
+	_, err := q.db.ExecContext(ctx, verificationCreate, arg.Column1, arg.TokenHash, arg.ExpiresAt)
+	return err
+}
+
+const verificationUse = `-- name: VerificationUse :one
+UPDATE email_verifications SET used_at=now()
+WHERE token_hash=$1 AND used_at IS NULL AND expires_at > now()
+RETURNING user_id
+`
+
+func (q *Queries) VerificationUse(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, verificationUse, tokenHash)
+	var user_id uuid.UUID
+	err := row.Scan(&user_id)
+	return user_id, err
+}
+
+const verificationsDeleteByUser = `-- name: VerificationsDeleteByUser :exec
+DELETE FROM email_verifications WHERE user_id=$1::uuid AND used_at IS NULL
+`
+
+func (q *Queries) VerificationsDeleteByUser(ctx context.Context, dollar_1 uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, verificationsDeleteByUser, dollar_1)
+	return err
+}
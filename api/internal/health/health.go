@@ -0,0 +1,127 @@
+// Package health serves the liveness, readiness and version probes.
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tim/eureka/internal/buildinfo"
+	"github.com/tim/eureka/internal/db"
+	"github.com/tim/eureka/internal/middleware"
+	"github.com/tim/eureka/internal/migrate"
+)
+
+// Check is one dependency readiness depends on.
+type Check struct {
+	Name string
+	Fn   func(context.Context) error
+}
+
+// Health runs the readiness checks. Timeout bounds each check.
+type Health struct {
+	Checks  []Check
+	Timeout time.Duration
+
+	draining atomic.Bool
+}
+
+// Drain makes readiness fail from now on, so load balancers stop sending
+// traffic while the server shuts down.
+func (h *Health) Drain() { h.draining.Store(true) }
+
+type report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Live answers as long as the process serves HTTP.
+func Live(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte("ok"))
+}
+
+// Ready runs every check concurrently and answers 200 when all pass, 503
+// otherwise. The response names the failed checks; the errors themselves
+// only go to the log, since the endpoint is unauthenticated.
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		write(w, http.StatusServiceUnavailable, report{Status: "draining"})
+		return
+	}
+	rep := report{Status: "ok", Checks: make(map[string]string, len(h.Checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range h.Checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), h.Timeout)
+			defer cancel()
+			res := "ok"
+			if err := c.Fn(ctx); err != nil {
+				middleware.Log(r.Context()).Warn("readiness check failed", "check", c.Name, "err", err)
+				res = "fail"
+			}
+			mu.Lock()
+			rep.Checks[c.Name] = res
+			if res != "ok" {
+				rep.Status = "unavailable"
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	code := http.StatusOK
+	if rep.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	write(w, code, rep)
+}
+
+// Version writes the build's version, commit and build time.
+func Version(w http.ResponseWriter, _ *http.Request) {
+	write(w, http.StatusOK, buildinfo.Get())
+}
+
+func write(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// Database pings the database.
+func Database(d *sql.DB) Check {
+	return Check{Name: "database", Fn: d.PingContext}
+}
+
+// Schema passes when the applied migrations are at least the newest one
+// this build ships and none is half-applied. A newer schema is accepted so
+// old instances stay ready during a rolling deploy.
+func Schema(m *migrate.Migrator) Check {
+	return Check{Name: "schema", Fn: func(ctx context.Context) error {
+		v, dirty, err := m.Version(ctx)
+		switch {
+		case err != nil:
+			return err
+		case dirty:
+			return fmt.Errorf("migration %d is dirty", v)
+		case v < m.Latest():
+			return fmt.Errorf("at version %d, expected %d", v, m.Latest())
+		}
+		return nil
+	}}
+}
+
+// Images checks that the image store, the images table, can be read.
+func Images(q *db.Queries) Check {
+	return Check{Name: "images", Fn: func(ctx context.Context) error {
+		return q.ImagesReachable(ctx)
+	}}
+}
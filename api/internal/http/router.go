@@ -1,89 +1,309 @@
 package httpx
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
 	"github.com/tim/eureka/internal/auth"
+	apperr "github.com/tim/eureka/internal/errors"
+	"github.com/tim/eureka/internal/health"
+	"github.com/tim/eureka/internal/metrics"
 	"github.com/tim/eureka/internal/middleware"
+	"github.com/tim/eureka/internal/openapi"
 	"github.com/tim/eureka/internal/service"
+	"github.com/tim/eureka/internal/tracing"
 )
 
-func Router(svc *service.Service, jwtSecret string) http.Handler {
+const oidcStateCookie = "eureka_oidc_state"
+
+// Options are the router settings that are not part of the service.
+type Options struct {
+	TokenTTL    time.Duration  // lifetime of access tokens
+	CORSOrigins []string       // "*" allows any origin
+	Metrics     http.Handler   // served at /metrics when not nil
+	LogSample   float64        // share of successful requests in the access log
+	Health      *health.Health // readiness checks behind /readyz
+}
+
+func Router(svc *service.Service, keys *auth.Keys, opts Options) http.Handler {
 	r := chi.NewRouter()
 
-	r.Use(middleware.Recovery)
 	r.Use(middleware.RequestID)
-	r.Use(middleware.Logger)
+	r.Use(tracing.Middleware(r))
+	r.Use(middleware.Logger(r, opts.LogSample))
+	// Inside the logger, so a panic is logged with the request's fields and
+	// its access log line shows the 500.
+	r.Use(middleware.Recovery)
+	r.Use(metrics.Middleware(r))
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"*"},
+		AllowedOrigins:   opts.CORSOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Authorization", "Content-Type", "X-Request-ID"},
 		AllowCredentials: false,
 		ExposedHeaders:   []string{"X-Request-ID"},
 	}))
 
-	r.Get("/healthz", func(w http.ResponseWriter, _ *http.Request) { w.Write([]byte("ok")) })
+	r.Get("/livez", health.Live)
+	r.Get("/healthz", health.Live)
+	if opts.Health != nil {
+		r.Get("/readyz", opts.Health.Ready)
+	}
+	r.Get("/version", health.Version)
+	r.Get("/api/openapi.json", openapi.Handler)
+	if opts.Metrics != nil {
+		r.Method(http.MethodGet, "/metrics", opts.Metrics)
+	}
+	r.Get("/.well-known/jwks.json", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		JSON(w, 200, keys.JWKS())
+	})
 
-	r.Get("/api/images/{id}", svc.GetImage)
+	// Public routes are validated here; the protected ones only after
+	// authentication, below.
+	pub := r.With(openapi.Validate(r))
 
-	r.Post("/api/auth/register", func(w http.ResponseWriter, r *http.Request) {
-		var req struct{ Email, Password string }
+	pub.Get("/api/images/{id}", svc.GetImage)
+
+	pub.Post("/api/auth/register", func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ Email, Password, InviteCode string }
 		if !Bind(w, r, &req) {
 			return
 		}
-		u, err := svc.Register(r.Context(), req.Email, req.Password)
+		u, err := svc.Register(r.Context(), req.Email, req.Password, req.InviteCode)
 		if err != nil {
+			var ae *apperr.AppError
+			if errors.As(err, &ae) {
+				http.Error(w, ae.Message, ae.Status)
+				return
+			}
 			http.Error(w, err.Error(), 400)
 			return
 		}
 		JSON(w, 201, map[string]string{"id": u})
 	})
 
-	r.Post("/api/auth/login", func(w http.ResponseWriter, r *http.Request) {
+	pub.Post("/api/auth/login", func(w http.ResponseWriter, r *http.Request) {
 		var req struct{ Email, Password string }
 		if !Bind(w, r, &req) {
 			return
 		}
-		uid, role, err := svc.Login(r.Context(), req.Email, req.Password)
+		uid, role, err := svc.Login(r.Context(), svc.ClientIP(r), req.Email, req.Password)
+		if throttled(w, err) {
+			return
+		}
+		if errors.Is(err, service.ErrTwoFactorRequired) {
+			ch, _ := auth.MakeChallenge(keys, uid, 5*time.Minute)
+			JSON(w, 200, map[string]any{"twoFactorRequired": true, "challengeToken": ch})
+			return
+		}
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			http.Error(w, "email not verified", 403)
+			return
+		}
+		if errors.Is(err, service.ErrAccountDisabled) {
+			http.Error(w, "account disabled", 403)
+			return
+		}
 		if err != nil {
 			http.Error(w, "unauthorized", 401)
 			return
 		}
-		tok, _ := auth.MakeToken(jwtSecret, uid, role, 24*time.Hour)
+		tok, _ := auth.MakeToken(keys, uid, role, opts.TokenTTL)
 		JSON(w, 200, map[string]string{"accessToken": tok})
 	})
 
+	pub.Post("/api/auth/2fa", func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ ChallengeToken, Code string }
+		if !Bind(w, r, &req) {
+			return
+		}
+		uid, err := auth.ParseChallenge(keys, req.ChallengeToken)
+		if err != nil {
+			http.Error(w, "unauthorized", 401)
+			return
+		}
+		role, err := svc.CompleteTwoFactor(r.Context(), svc.ClientIP(r), uid, req.Code)
+		if throttled(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, "unauthorized", 401)
+			return
+		}
+		tok, _ := auth.MakeTwoFactorToken(keys, uid, role, opts.TokenTTL)
+		JSON(w, 200, map[string]string{"accessToken": tok})
+	})
+
+	if op := svc.SSO.Provider; op != nil {
+		pub.Get("/api/auth/oidc/login", func(w http.ResponseWriter, r *http.Request) {
+			state, to, err := op.Start()
+			if err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+			// The cookie ties the callback to the browser that started the
+			// login.
+			http.SetCookie(w, &http.Cookie{
+				Name: oidcStateCookie, Value: state, Path: "/api/auth/oidc",
+				MaxAge: 600, HttpOnly: true, Secure: r.TLS != nil, SameSite: http.SameSiteLaxMode,
+			})
+			http.Redirect(w, r, to, http.StatusFound)
+		})
+
+		pub.Get("/api/auth/oidc/callback", func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			if e := q.Get("error"); e != "" {
+				http.Error(w, "sso: "+e, 401)
+				return
+			}
+			c, err := r.Cookie(oidcStateCookie)
+			if err != nil || c.Value == "" || c.Value != q.Get("state") {
+				http.Error(w, "bad state", 400)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/auth/oidc", MaxAge: -1})
+			id, err := op.Finish(r.Context(), q.Get("state"), q.Get("code"))
+			if err != nil {
+				http.Error(w, "unauthorized", 401)
+				return
+			}
+			uid, role, err := svc.SSOLogin(r.Context(), id)
+			// The web app reads the token from the fragment, which never
+			// reaches a server log.
+			back := strings.TrimRight(svc.AppURL, "/") + "/auth/callback#"
+			if errors.Is(err, service.ErrTwoFactorRequired) {
+				ch, _ := auth.MakeChallenge(keys, uid, 5*time.Minute)
+				http.Redirect(w, r, back+"challengeToken="+url.QueryEscape(ch), http.StatusFound)
+				return
+			}
+			if err != nil {
+				var ae *apperr.AppError
+				if errors.As(err, &ae) {
+					http.Error(w, ae.Message, ae.Status)
+					return
+				}
+				http.Error(w, err.Error(), 500)
+				return
+			}
+			tok, _ := auth.MakeToken(keys, uid, role, opts.TokenTTL)
+			http.Redirect(w, r, back+"accessToken="+url.QueryEscape(tok), http.StatusFound)
+		})
+	}
+
+	pub.Post("/api/auth/forgot-password", svc.ForgotPassword)
+	pub.Post("/api/auth/reset-password", svc.ResetPassword)
+	pub.Post("/api/auth/verify-email", svc.VerifyEmailToken)
+	pub.Post("/api/auth/resend-verification", svc.ResendVerification)
+
 	ap := chi.NewRouter()
-	ap.Use(auth.AuthMiddleware(jwtSecret))
+	ap.Use(auth.AuthMiddleware(keys, svc.TokensRevokedAt, svc.LookupAccessToken))
+	ap.Use(logUser)
+	ap.Use(svc.TwoFactorPolicy)
+	ap.Use(auth.RequireWriteScope)
+	ap.Use(openapi.Validate(r))
+	// can guards privileged routes by permission. auth.Can also applies
+	// the 2FA policy, here and in the handlers that check *Any permissions.
+	can := func(p auth.Permission) chi.Router {
+		return ap.With(auth.RequirePermission(p))
+	}
+	wr := ap.With(auth.RequirePermission(auth.PagesWrite))
+	// Credentials can only be managed from a login session, not with an
+	// access token.
+	sess := ap.With(auth.RequireSession)
+
+	ap.Get("/api/me", svc.Me)
+	sess.Put("/api/me/password", svc.ChangePassword)
+	sess.Put("/api/me/email", svc.ChangeEmail)
+	sess.Delete("/api/me", svc.DeleteMe)
+	sess.Get("/api/me/2fa", svc.TwoFactorStatus)
+	sess.Post("/api/me/2fa/enroll", svc.TwoFactorEnroll)
+	sess.Post("/api/me/2fa/confirm", svc.TwoFactorConfirm)
+	sess.Post("/api/me/2fa/recovery-codes", svc.TwoFactorRecoveryCodes)
+	sess.Delete("/api/me/2fa", svc.TwoFactorDisable)
+	sess.Get("/api/me/tokens", svc.ListTokens)
+	sess.Post("/api/me/tokens", svc.CreateToken)
+	sess.Delete("/api/me/tokens/{id}", svc.DeleteToken)
 
 	ap.Get("/api/pages", svc.ListPages)
-	ap.Post("/api/pages", svc.CreatePage)
+	wr.Post("/api/pages", svc.CreatePage)
 	ap.Get("/api/pages/{id}", svc.GetPage)
-	ap.Put("/api/pages/{id}", svc.UpdatePage)
-	ap.Delete("/api/pages/{id}", svc.DeletePage)
+	ap.Get("/api/pages/{id}/render", svc.RenderPage)
+	wr.Put("/api/pages/{id}", svc.UpdatePage)
+	wr.Delete("/api/pages/{id}", svc.DeletePage)
+	ap.Get("/api/trash", svc.ListTrash)
+	wr.Delete("/api/trash", svc.EmptyTrash)
+	wr.Post("/api/trash/{id}/restore", svc.RestorePage)
+	wr.Delete("/api/trash/{id}", svc.PurgePage)
 
-	ap.With(auth.RequireRole("adm")).Patch("/api/pages/{id}/owner", svc.ChangeOwner)
-	ap.With(auth.RequireRole("adm")).Post("/api/admin/pages/{id}/owner", svc.ChangeOwner)
+	can(auth.PagesTransfer).Patch("/api/pages/{id}/owner", svc.ChangeOwner)
+	can(auth.PagesTransfer).Post("/api/admin/pages/{id}/owner", svc.ChangeOwner)
 
 	ap.Get("/api/pages/{id}/links", svc.ListLinks)
-	ap.Post("/api/pages/{id}/links", svc.AddLink)
-	ap.Delete("/api/links/{id}", svc.DelLink)
+	wr.Post("/api/pages/{id}/links", svc.AddLink)
+	wr.Delete("/api/links/{id}", svc.DelLink)
 
 	ap.Get("/api/pages/{id}/images", svc.ListImages)
-	ap.Post("/api/pages/{id}/images", svc.UploadImage)
+	wr.Post("/api/pages/{id}/images", svc.UploadImage)
 
 	ap.Get("/api/graph", svc.UserGraph)
 
-	ap.With(auth.RequireRole("adm")).Get("/api/admin/pages", svc.AdminPages)
-	ap.With(auth.RequireRole("adm")).Get("/api/admin/users", svc.AdminUsers)
-	ap.With(auth.RequireRole("adm")).Delete("/api/admin/users/{id}", svc.AdminDeleteUser)
-	ap.With(auth.RequireRole("adm")).Delete("/api/admin/pages/{id}", svc.AdminDeletePage)
+	ap.Get("/api/tags", svc.ListTags)
+	ap.Get("/api/tags/pages", svc.TagPages)
+	wr.Post("/api/tags/rename", svc.RenameTag)
+
+	can(auth.PagesReadAny).Get("/api/admin/pages", svc.AdminPages)
+	can(auth.PagesDeleteAny).Delete("/api/admin/pages/{id}", svc.AdminDeletePage)
+	can(auth.UsersRead).Get("/api/admin/users", svc.AdminUsers)
+	can(auth.UsersManage).Post("/api/admin/users", svc.AdminCreateUser)
+	can(auth.UsersManage).Get("/api/admin/users/{id}/delete-preview", svc.AdminUserDeletionPreview)
+	can(auth.UsersManage).Delete("/api/admin/users/{id}", svc.AdminDeleteUser)
+	can(auth.UsersManage).Get("/api/admin/archive", svc.AdminArchivedPages)
+	can(auth.UsersManage).Post("/api/admin/users/{id}/disable", svc.AdminDisableUser)
+	can(auth.UsersManage).Post("/api/admin/users/{id}/enable", svc.AdminEnableUser)
+	can(auth.UsersManage).Post("/api/admin/users/{id}/reset-password", svc.AdminForcePasswordReset)
+	can(auth.UsersManage).Put("/api/admin/users/{id}/role", svc.AdminSetRole)
+	can(auth.UsersRead).Get("/api/admin/roles", svc.AdminRoles)
+	can(auth.UsersRead).Get("/api/admin/users/locked", svc.AdminLockedUsers)
+	can(auth.UsersManage).Post("/api/admin/users/{id}/unlock", svc.AdminUnlockUser)
+	can(auth.UsersManage).Get("/api/admin/invites", svc.AdminInvites)
+	can(auth.UsersManage).Post("/api/admin/invites", svc.AdminCreateInvite)
+	can(auth.UsersManage).Delete("/api/admin/invites/{id}", svc.AdminDeleteInvite)
+	can(auth.AuditRead).Get("/api/admin/audit", svc.AdminAudit)
+	can(auth.AuditRead).Get("/api/admin/audit/export", svc.AdminAuditExport)
+	can(auth.SettingsManage).Get("/api/admin/settings/2fa", svc.AdminTwoFactorPolicy)
+	can(auth.SettingsManage).Put("/api/admin/settings/2fa", svc.AdminSetTwoFactorPolicy)
 
 	r.Mount("/", ap)
 	_ = os.Setenv("TZ", "UTC")
 	return r
 }
+
+// logUser adds the authenticated user's ID to the request's log lines.
+func logUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if uid, ok := r.Context().Value(auth.CtxUserID).(string); ok {
+			middleware.AddLogAttrs(r.Context(), "user_id", uid)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// throttled answers 429 with Retry-After if err is a
+// service.ThrottledError.
+func throttled(w http.ResponseWriter, err error) bool {
+	var te *service.ThrottledError
+	if !errors.As(err, &te) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(te.RetryAfter.Seconds()))))
+	http.Error(w, "too many login attempts", 429)
+	return true
+}
@@ -0,0 +1,267 @@
+package httpx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/tim/eureka/internal/auth"
+	"github.com/tim/eureka/internal/db"
+	"github.com/tim/eureka/internal/health"
+	"github.com/tim/eureka/internal/oidc"
+	"github.com/tim/eureka/internal/openapi"
+	"github.com/tim/eureka/internal/service"
+)
+
+// testRouter builds the router with every optional route switched on:
+// single sign-on, /metrics and /readyz.
+func testRouter(t *testing.T) chi.Routes {
+	h, _ := newTestRouter(t, nil)
+	return h
+}
+
+// newTestRouter is testRouter with the service reading from q, and the keys
+// that sign its tokens.
+func newTestRouter(t *testing.T, q *db.Queries) (chi.Routes, *auth.Keys) {
+	var issuer string
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 issuer,
+			"authorization_endpoint": issuer + "/authorize",
+			"token_endpoint":         issuer + "/token",
+			"jwks_uri":               issuer + "/jwks",
+		})
+	}))
+	t.Cleanup(idp.Close)
+	issuer = idp.URL
+	op, err := oidc.New(context.Background(), oidc.Config{Issuer: issuer, ClientID: "eureka"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := auth.NewKeys(auth.HMACKey("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := &service.Service{Q: q, SSO: service.SSO{Provider: op}}
+	h := Router(svc, keys, Options{
+		Metrics: http.NotFoundHandler(),
+		Health:  &health.Health{},
+	})
+	return h.(chi.Routes), keys
+}
+
+// TestRoutesHaveSpec fails when a route is added to the router without an
+// operation in openapi.yaml, or an operation outlives its route.
+func TestRoutesHaveSpec(t *testing.T) {
+	routes := map[string]bool{}
+	err := chi.Walk(testRouter(t), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		route = strings.TrimSuffix(route, "/")
+		routes[method+" "+route] = true
+		if openapi.Lookup(method, route) == nil {
+			t.Errorf("%s %s has no operation in openapi.yaml", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range openapi.Routes() {
+		if !routes[r] {
+			t.Errorf("openapi.yaml describes %s, which the router does not serve", r)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	h := testRouter(t).(http.Handler)
+	big := `{"email":"` + strings.Repeat("a", openapi.MaxJSONBody) + `"}`
+	for _, tc := range []struct {
+		method, path, body string
+		code               int
+		want               string
+	}{
+		{"POST", "/api/auth/login", `{"email":"a@b.c"}`, 400, "body.password: required"},
+		{"POST", "/api/auth/login", `{"Email":"a@b.c","Password":1}`, 400, "body.password: must be a string"},
+		{"POST", "/api/auth/login", `[]`, 400, "body: must be an object"},
+		{"POST", "/api/auth/login", `{`, 400, "bad json"},
+		{"POST", "/api/auth/login", big, 413, "body too large"},
+		{"POST", "/api/auth/reset-password", ``, 400, "body required"},
+		{"GET", "/api/images/nope", ``, 400, "id: must be a UUID"},
+		// Protected routes are validated only once the caller is
+		// authenticated.
+		{"GET", "/api/admin/audit?limit=5000", ``, 401, "no token"},
+		{"GET", "/api/tags/pages", ``, 401, "no token"},
+		{"POST", "/api/pages", `[]`, 401, "no token"},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if got := strings.TrimSpace(rec.Body.String()); rec.Code != tc.code || got != tc.want {
+			t.Errorf("%s %s %.40s: got %d %q, want %d %q", tc.method, tc.path, tc.body, rec.Code, got, tc.code, tc.want)
+		}
+	}
+}
+
+func TestSpecServed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	testRouter(t).(http.Handler).ServeHTTP(rec, httptest.NewRequest("GET", "/api/openapi.json", nil))
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]any
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != 200 || doc.OpenAPI != "3.0.3" || doc.Paths["/api/pages/{id}"] == nil {
+		t.Fatalf("got %d %s", rec.Code, rec.Body.String()[:min(200, rec.Body.Len())])
+	}
+}
+
+// TestTwoFactorPolicy checks that the 2FA policy holds wherever a privileged
+// permission is used, including handlers that check it themselves.
+func TestTwoFactorPolicy(t *testing.T) {
+	adm, other, page := uuid.NewString(), uuid.NewString(), uuid.NewString()
+	epoch := time.Unix(0, 0)
+	pageURL := "/api/pages/" + page
+	for _, tc := range []struct {
+		name               string
+		policy, twoFA      bool
+		method, path, body string
+		code               int
+		want               string
+	}{
+		{"password only", true, false, "GET", pageURL, "", 403, "forbidden"},
+		{"password only", true, false, "GET", pageURL + "?expand=true", "", 403, "forbidden"},
+		{"password only", true, false, "GET", pageURL + "/render", "", 403, "forbidden"},
+		{"password only", true, false, "PUT", pageURL, `{"name":"x","body":"y"}`, 403, "forbidden"},
+		{"password only", true, false, "DELETE", pageURL, "", 403, "forbidden"},
+		{"password only", true, false, "DELETE", "/api/trash/" + page, "", 404, "not found"},
+		{"password only", true, false, "GET", "/api/admin/users", "", 403, "two-factor authentication required"},
+		{"second factor", true, true, "GET", pageURL, "", 200, ""},
+		{"second factor", true, true, "GET", pageURL + "/render", "", 200, ""},
+		{"second factor", true, true, "PUT", pageURL, `{"name":"x","body":"y"}`, 200, ""},
+		{"policy off", false, false, "GET", pageURL + "/render", "", 200, ""},
+	} {
+		rows := fakeRows{
+			"UserRevokedAt":   {{epoch}},
+			"UserByID":        {{adm, "a@b.cd", "x", "adm", epoch, epoch, int64(0), nil, "SECRET", epoch, int64(0), nil, nil}},
+			"PageByID":        {{page, other, "Other's page", "secret notes", epoch}},
+			"PageOwner":       {{other}},
+			"PageTrashedByID": {{other, "Other's page", "secret notes"}},
+		}
+		if tc.policy {
+			rows["SettingGet"] = [][]driver.Value{{"true"}}
+		}
+		h, keys := newTestRouter(t, db.New(sql.OpenDB(rows)))
+		sign := auth.MakeToken
+		if tc.twoFA {
+			sign = auth.MakeTwoFactorToken
+		}
+		tok, err := sign(keys, adm, "adm", time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Authorization", "Bearer "+tok)
+		rec := httptest.NewRecorder()
+		h.(http.Handler).ServeHTTP(rec, req)
+		if rec.Code != tc.code || (tc.want != "" && strings.TrimSpace(rec.Body.String()) != tc.want) {
+			t.Errorf("%s: %s %s: got %d %q, want %d %q", tc.name, tc.method, tc.path, rec.Code, rec.Body.String(), tc.code, tc.want)
+		}
+	}
+}
+
+// TestRenderCache checks that a cached render is served while the page and
+// its owner's pages are unchanged, and dropped when a linked page is
+// created or renamed.
+func TestRenderCache(t *testing.T) {
+	user, page, linked := uuid.NewString(), uuid.NewString(), uuid.NewString()
+	epoch := time.Unix(0, 0)
+	rows := fakeRows{
+		"UserRevokedAt": {{epoch}},
+		"PageByID":      {{page, user, "Mine", "see [[New]]", epoch}},
+		"PagesByUser":   {{page, "Mine", epoch}},
+	}
+	h, keys := newTestRouter(t, db.New(sql.OpenDB(rows)))
+	tok, err := auth.MakeToken(keys, user, "user", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	render := func() string {
+		req := httptest.NewRequest("GET", "/api/pages/"+page+"/render", nil)
+		req.Header.Set("Authorization", "Bearer "+tok)
+		rec := httptest.NewRecorder()
+		h.(http.Handler).ServeHTTP(rec, req)
+		if rec.Code != 200 {
+			t.Fatalf("got %d %s", rec.Code, rec.Body.String())
+		}
+		return rec.Body.String()
+	}
+	missing, link := "wiki-link-missing", `data-page-id="`+linked+`"`
+
+	if got := render(); !strings.Contains(got, missing) {
+		t.Errorf("before New exists: %s", got)
+	}
+	rows["PagesByUser"] = [][]driver.Value{{linked, "New", epoch.Add(time.Second)}, {page, "Mine", epoch}}
+	if got := render(); !strings.Contains(got, link) {
+		t.Errorf("after New is created: %s", got)
+	}
+	// Same updated_at: the cached render is served without rendering the body.
+	rows["PageByID"] = [][]driver.Value{{page, user, "Mine", "changed", epoch}}
+	if got := render(); !strings.Contains(got, link) {
+		t.Errorf("cache not used: %s", got)
+	}
+	rows["PageByID"] = [][]driver.Value{{page, user, "Mine", "see [[New]]", epoch}}
+	rows["PagesByUser"] = [][]driver.Value{{linked, "Old", epoch.Add(2 * time.Second)}, {page, "Mine", epoch}}
+	if got := render(); !strings.Contains(got, missing) || strings.Contains(got, link) {
+		t.Errorf("after New is renamed: %s", got)
+	}
+}
+
+// fakeRows is a database that answers each sqlc query by its name with
+// canned rows, and no rows for queries it does not know. Writes succeed.
+type fakeRows map[string][][]driver.Value
+
+func (f fakeRows) Connect(context.Context) (driver.Conn, error) { return f, nil }
+func (f fakeRows) Driver() driver.Driver                        { return nil }
+func (f fakeRows) Prepare(string) (driver.Stmt, error)          { return nil, driver.ErrSkip }
+func (f fakeRows) Close() error                                 { return nil }
+func (f fakeRows) Begin() (driver.Tx, error)                    { return nil, driver.ErrSkip }
+
+func (f fakeRows) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	name, _, _ := strings.Cut(strings.TrimPrefix(query, "-- name: "), " ")
+	return &cannedRows{rows: f[name]}, nil
+}
+
+func (f fakeRows) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+type cannedRows struct{ rows [][]driver.Value }
+
+func (r *cannedRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return []string{"?"}
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *cannedRows) Close() error { return nil }
+
+func (r *cannedRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,88 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// SMTP sends mail through an SMTP relay, using PLAIN auth when Username is
+// set.
+type SMTP struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (s *SMTP) Send(_ context.Context, m Message) error {
+	var a smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		a = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	return smtp.SendMail(s.Addr, a, s.From, []string{m.To}, format(s.From, m))
+}
+
+// File writes every message to Dir as an .eml file, for local development
+// and tests.
+type File struct {
+	Dir  string
+	From string
+}
+
+func (f *File) Send(_ context.Context, m Message) error {
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return err
+	}
+	name := time.Now().UTC().Format("20060102T150405") + "-" + uuid.NewString() + ".eml"
+	return os.WriteFile(filepath.Join(f.Dir, name), format(f.From, m), 0o600)
+}
+
+// Log records messages in the server log instead of sending them. The body
+// is left out: it carries one-time links that must not end up in log
+// storage. Use File to read the messages in development.
+type Log struct{}
+
+func (Log) Send(_ context.Context, m Message) error {
+	slog.Warn("mail not sent", "to", m.To, "subject", m.Subject)
+	return nil
+}
+
+func format(from string, m Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", header(from))
+	fmt.Fprintf(&b, "To: %s\r\n", header(m.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", header(m.Subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+func header(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
@@ -0,0 +1,135 @@
+// Package metrics exposes Prometheus metrics: HTTP requests by chi route
+// pattern, the database pool, content totals, and counters the service
+// updates for login failures and image uploads.
+package metrics
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tim/eureka/internal/db"
+	"github.com/tim/eureka/internal/middleware"
+)
+
+var (
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "eureka_http_requests_total",
+		Help: "HTTP requests by method, route pattern and status.",
+	}, []string{"method", "route", "status"})
+
+	latency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "eureka_http_request_duration_seconds",
+		Help:    "HTTP request latency by method, route pattern and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// LoginFailures counts rejected logins by reason: "password" for a bad
+	// email or password, "second_factor" for a bad TOTP or recovery code,
+	// and "throttled" for attempts refused by backoff or an account lock.
+	LoginFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "eureka_login_failures_total",
+		Help: "Rejected login attempts by reason.",
+	}, []string{"reason"})
+
+	// ImageUploads counts uploads by result: "ok", "too_large" or
+	// "bad_type".
+	ImageUploads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "eureka_image_uploads_total",
+		Help: "Image uploads by result.",
+	}, []string{"result"})
+
+	ImageUploadBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "eureka_image_upload_bytes_total",
+		Help: "Bytes of images stored by uploads.",
+	})
+)
+
+// Middleware records every request under its chi route pattern (see
+// middleware.RoutePattern), so /api/pages/{id} is one series however many
+// pages there are.
+func Middleware(routes chi.Routes) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := middleware.Record(w)
+			next.ServeHTTP(rec, r)
+
+			route := middleware.RoutePattern(routes, r)
+			status := strconv.Itoa(rec.Status)
+			requests.WithLabelValues(r.Method, route, status).Inc()
+			latency.WithLabelValues(r.Method, route, status).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
+// Handler serves the metrics above together with Go runtime, process and
+// sqlDB pool statistics and the content totals, which are counted on each
+// scrape.
+func Handler(sqlDB *sql.DB) http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(sqlDB, "eureka"),
+		requests, latency, LoginFailures, ImageUploads, ImageUploadBytes,
+		&content{q: db.New(sqlDB)},
+	)
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError})
+}
+
+// RequireToken lets through only requests with "Authorization: Bearer
+// token".
+func RequireToken(token string, next http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			http.Error(w, "unauthorized", 401)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+var (
+	usersDesc      = prometheus.NewDesc("eureka_users", "Registered users.", nil, nil)
+	pagesDesc      = prometheus.NewDesc("eureka_pages", "Pages by state: live or trashed.", []string{"state"}, nil)
+	linksDesc      = prometheus.NewDesc("eureka_links", "Links between pages.", nil, nil)
+	imageBytesDesc = prometheus.NewDesc("eureka_image_bytes", "Bytes of stored images.", nil, nil)
+)
+
+// content reports the content totals from the database.
+type content struct {
+	q *db.Queries
+}
+
+func (c *content) Describe(ch chan<- *prometheus.Desc) {
+	ch <- usersDesc
+	ch <- pagesDesc
+	ch <- linksDesc
+	ch <- imageBytesDesc
+}
+
+func (c *content) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	t, err := c.q.ContentTotals(ctx)
+	if err != nil {
+		slog.Error("metrics: content totals", "err", err)
+		ch <- prometheus.NewInvalidMetric(usersDesc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(usersDesc, prometheus.GaugeValue, float64(t.Users))
+	ch <- prometheus.MustNewConstMetric(pagesDesc, prometheus.GaugeValue, float64(t.Pages), "live")
+	ch <- prometheus.MustNewConstMetric(pagesDesc, prometheus.GaugeValue, float64(t.Trashed), "trashed")
+	ch <- prometheus.MustNewConstMetric(linksDesc, prometheus.GaugeValue, float64(t.Links))
+	ch <- prometheus.MustNewConstMetric(imageBytesDesc, prometheus.GaugeValue, float64(t.ImageBytes))
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+const logFieldsKey contextKey = "log_fields"
+
+// logFields holds the attributes of one request's log lines. Logger
+// creates it; middlewares and handlers further in add to it with
+// AddLogAttrs.
+type logFields struct {
+	mu    sync.Mutex
+	attrs []any
+}
+
+func withLogFields(ctx context.Context, args ...any) (context.Context, *logFields) {
+	f := &logFields{attrs: args}
+	return context.WithValue(ctx, logFieldsKey, f), f
+}
+
+func (f *logFields) list() []any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]any(nil), f.attrs...)
+}
+
+// AddLogAttrs adds key-value pairs to the current request's access log line
+// and to everything logged through Log(ctx) from then on. Outside a request
+// it does nothing.
+func AddLogAttrs(ctx context.Context, args ...any) {
+	f, ok := ctx.Value(logFieldsKey).(*logFields)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	f.attrs = append(f.attrs, args...)
+	f.mu.Unlock()
+}
+
+// Log returns the default logger with the request ID, user ID and other
+// attributes of the request in ctx, or the default logger outside a
+// request.
+func Log(ctx context.Context) *slog.Logger {
+	f, ok := ctx.Value(logFieldsKey).(*logFields)
+	if !ok {
+		return slog.Default()
+	}
+	return slog.Default().With(f.list()...)
+}
@@ -1,48 +1,73 @@
 package middleware
 
 import (
-	"log"
+	"log/slog"
+	"math/rand/v2"
 	"net/http"
 	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type responseWriter struct {
+// Recorder is a ResponseWriter that remembers the status code and the
+// number of body bytes written.
+type Recorder struct {
 	http.ResponseWriter
-	statusCode int
-	written    int
+	Status  int
+	Written int
+}
+
+func Record(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w, Status: http.StatusOK}
 }
 
-func (rw *responseWriter) WriteHeader(code int) {
-	rw.statusCode = code
+func (rw *Recorder) WriteHeader(code int) {
+	rw.Status = code
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-func (rw *responseWriter) Write(b []byte) (int, error) {
+func (rw *Recorder) Write(b []byte) (int, error) {
 	n, err := rw.ResponseWriter.Write(b)
-	rw.written += n
+	rw.Written += n
 	return n, err
 }
 
-func Logger(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-
-		wrapped := &responseWriter{
-			ResponseWriter: w,
-			statusCode:     http.StatusOK,
-		}
-
-		next.ServeHTTP(wrapped, r)
-
-		duration := time.Since(start)
-		log.Printf(
-			"[%s] %s %s - %d (%v) %d bytes",
-			r.Method,
-			r.RemoteAddr,
-			r.URL.Path,
-			wrapped.statusCode,
-			duration,
-			wrapped.written,
-		)
-	})
+// Logger writes one access log line per request, with the request ID, the
+// trace ID when the request is traced, the route pattern, status, latency
+// and bytes, plus anything added with AddLogAttrs such as the user ID. It
+// must run after RequestID. Only the sample share of requests below 400 is
+// logged; 5xx responses are logged at error level.
+func Logger(routes chi.Routes, sample float64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			fields := []any{"request_id", GetRequestID(r.Context())}
+			if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+				fields = append(fields, "trace_id", sc.TraceID().String())
+			}
+			ctx, f := withLogFields(r.Context(), fields...)
+
+			wrapped := Record(w)
+			next.ServeHTTP(wrapped, r.WithContext(ctx))
+
+			if wrapped.Status < 400 && sample < 1 && rand.Float64() >= sample {
+				return
+			}
+			level := slog.LevelInfo
+			if wrapped.Status >= 500 {
+				level = slog.LevelError
+			}
+			args := append(f.list(),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"route", RoutePattern(routes, r),
+				"status", wrapped.Status,
+				"latency_ms", float64(time.Since(start).Microseconds())/1000,
+				"bytes", wrapped.Written,
+				"remote", r.RemoteAddr,
+			)
+			slog.Default().Log(ctx, level, "request", args...)
+		})
+	}
 }
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RoutePattern returns the chi pattern that served r, such as
+// /api/pages/{id}, for use after the handler has run. When a middleware
+// rejected r before a mounted router picked its route, such as a 401 from
+// the auth check, r is matched against routes instead. Requests that match
+// no route give "unmatched".
+func RoutePattern(routes chi.Routes, r *http.Request) string {
+	route := ""
+	if rc := chi.RouteContext(r.Context()); rc != nil {
+		route = rc.RoutePattern()
+	}
+	if route != "" && !strings.HasSuffix(route, "/*") {
+		return route
+	}
+	if rc := chi.NewRouteContext(); routes.Match(rc, r.Method, r.URL.Path) {
+		return rc.RoutePattern()
+	}
+	return "unmatched"
+}
@@ -0,0 +1,260 @@
+// Package migrate applies the numbered NNN_name.up.sql / .down.sql
+// migrations. It keeps its state in the schema_migrations table used by
+// golang-migrate, so databases migrated with that tool carry on as they are.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// lockID is the advisory lock that keeps two migrators from running at once.
+const lockID = 7_414_053_301
+
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Load reads the migrations in the root of fsys, sorted by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[uint]*Migration{}
+	for _, f := range files {
+		base := strings.TrimSuffix(path.Base(f), ".sql")
+		base, dir, ok := cutLast(base, ".")
+		if !ok || (dir != "up" && dir != "down") {
+			return nil, fmt.Errorf("%s: want NNN_name.up.sql or NNN_name.down.sql", f)
+		}
+		num, name, _ := strings.Cut(base, "_")
+		v, err := strconv.ParseUint(num, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bad version", f)
+		}
+		b, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[uint(v)]
+		if m == nil {
+			m = &Migration{Version: uint(v), Name: name}
+			byVersion[uint(v)] = m
+		}
+		if dir == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up file", m.Version)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
+
+// ErrDirty means a migration failed halfway under golang-migrate. The
+// schema has to be repaired by hand and the version set with Force.
+var ErrDirty = errors.New("database is dirty; repair it and run migrate force <version>")
+
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+}
+
+// Status is the applied version and whether each migration is applied.
+type Status struct {
+	Version uint
+	Dirty   bool
+	Applied []bool // parallel to Migrator.Migrations
+}
+
+// Version returns the applied version, 0 for an empty database.
+func (m *Migrator) Version(ctx context.Context) (uint, bool, error) {
+	var v int64
+	var dirty bool
+	err := m.DB.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&v, &dirty)
+	if errors.Is(err, sql.ErrNoRows) || isUndefinedTable(err) {
+		return 0, false, nil
+	}
+	return uint(v), dirty, err
+}
+
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+	v, dirty, err := m.Version(ctx)
+	if err != nil {
+		return Status{}, err
+	}
+	st := Status{Version: v, Dirty: dirty, Applied: make([]bool, len(m.Migrations))}
+	for i, mg := range m.Migrations {
+		st.Applied[i] = mg.Version <= v
+	}
+	return st, nil
+}
+
+// Latest is the version of the newest migration.
+func (m *Migrator) Latest() uint {
+	if len(m.Migrations) == 0 {
+		return 0
+	}
+	return m.Migrations[len(m.Migrations)-1].Version
+}
+
+// Up applies all pending migrations, each in its own transaction, and
+// returns how many ran.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	n := 0
+	err := m.locked(ctx, func(conn *sql.Conn, v uint) error {
+		for _, mg := range m.Migrations {
+			if mg.Version <= v {
+				continue
+			}
+			if err := apply(ctx, conn, mg.Up, int64(mg.Version)); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mg.Version, mg.Name, err)
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Down rolls back the last steps applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	n := 0
+	err := m.locked(ctx, func(conn *sql.Conn, v uint) error {
+		for i := len(m.Migrations) - 1; i >= 0 && n < steps; i-- {
+			mg := m.Migrations[i]
+			if mg.Version > v {
+				continue
+			}
+			if mg.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down file", mg.Version, mg.Name)
+			}
+			var prev int64 = -1
+			if i > 0 {
+				prev = int64(m.Migrations[i-1].Version)
+			}
+			if err := apply(ctx, conn, mg.Down, prev); err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", mg.Version, mg.Name, err)
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Force sets the recorded version and clears the dirty flag without
+// running anything.
+func (m *Migrator) Force(ctx context.Context, version uint) error {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := setVersion(ctx, tx, int64(version)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// locked runs fn on one connection holding the advisory lock, with the
+// current version.
+func (m *Migrator) locked(ctx context.Context, fn func(*sql.Conn, uint) error) error {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	var v int64
+	var dirty bool
+	err = conn.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&v, &dirty)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("version %d: %w", v, ErrDirty)
+	}
+	return fn(conn, uint(v))
+}
+
+func ensureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)`)
+	return err
+}
+
+// apply runs a migration script and records version in one transaction.
+// A version below zero means no migration is applied.
+func apply(ctx context.Context, conn *sql.Conn, script string, version int64) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if err := setVersion(ctx, tx, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func setVersion(ctx context.Context, tx *sql.Tx, version int64) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+	if version < 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, version)
+	return err
+}
+
+func isUndefinedTable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "42P01"
+}
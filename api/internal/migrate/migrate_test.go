@@ -0,0 +1,138 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/tim/eureka/migrations"
+)
+
+func files(names ...string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for _, n := range names {
+		fsys[n] = &fstest.MapFile{Data: []byte("-- " + n)}
+	}
+	return fsys
+}
+
+func TestLoad(t *testing.T) {
+	ms, err := Load(files(
+		"010_ten.up.sql", "010_ten.down.sql",
+		"2_two.up.sql",
+		"001_one.down.sql", "001_one.up.sql",
+		"README.md",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Migration{
+		{1, "one", "-- 001_one.up.sql", "-- 001_one.down.sql"},
+		{2, "two", "-- 2_two.up.sql", ""},
+		{10, "ten", "-- 010_ten.up.sql", "-- 010_ten.down.sql"},
+	}
+	if !reflect.DeepEqual(ms, want) {
+		t.Errorf("got %+v", ms)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, tc := range []struct {
+		files []string
+		want  string
+	}{
+		{[]string{"001_one.sql"}, "want NNN_name.up.sql"},
+		{[]string{"001_one.sideways.sql"}, "want NNN_name.up.sql"},
+		{[]string{"one_001.up.sql"}, "bad version"},
+		{[]string{"-1_neg.up.sql"}, "bad version"},
+		{[]string{"001_one.up.sql", "002_two.down.sql"}, "migration 2 has no up file"},
+	} {
+		_, err := Load(files(tc.files...))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%v: got %v, want %q", tc.files, err, tc.want)
+		}
+	}
+}
+
+// TestEmbedded checks the shipped migrations: numbered from 1 without gaps
+// and each with a down file.
+func TestEmbedded(t *testing.T) {
+	ms, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range ms {
+		if m.Version != uint(i+1) {
+			t.Errorf("migration %d_%s: want version %d", m.Version, m.Name, i+1)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %d_%s has no down file", m.Version, m.Name)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	ms, err := Load(files("001_a.up.sql", "002_b.up.sql", "005_c.up.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		row     []driver.Value // schema_migrations, nil when empty
+		version uint
+		dirty   bool
+		applied []bool
+	}{
+		{nil, 0, false, []bool{false, false, false}},
+		{[]driver.Value{int64(2), false}, 2, false, []bool{true, true, false}},
+		{[]driver.Value{int64(5), true}, 5, true, []bool{true, true, true}},
+	} {
+		m := &Migrator{DB: sql.OpenDB(versionDB{tc.row}), Migrations: ms}
+		st, err := m.Status(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := Status{Version: tc.version, Dirty: tc.dirty, Applied: tc.applied}
+		if !reflect.DeepEqual(st, want) {
+			t.Errorf("row %v: got %+v, want %+v", tc.row, st, want)
+		}
+		if m.Latest() != 5 {
+			t.Errorf("Latest = %d", m.Latest())
+		}
+	}
+}
+
+// versionDB is a database whose every query returns row, or no rows when
+// it is nil.
+type versionDB struct{ row []driver.Value }
+
+func (c versionDB) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c versionDB) Driver() driver.Driver                        { return nil }
+func (c versionDB) Prepare(string) (driver.Stmt, error)          { return nil, driver.ErrSkip }
+func (c versionDB) Close() error                                 { return nil }
+func (c versionDB) Begin() (driver.Tx, error)                    { return nil, driver.ErrSkip }
+
+func (c versionDB) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return &rows{row: c.row}, nil
+}
+
+type rows struct {
+	row  []driver.Value
+	done bool
+}
+
+func (r *rows) Columns() []string { return []string{"version", "dirty"} }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.done || r.row == nil {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.row)
+	return nil
+}
@@ -0,0 +1,197 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIdP is a minimal OpenID provider: discovery, JWKS and a token
+// endpoint that checks the PKCE verifier.
+type mockIdP struct {
+	srv *httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]grant
+}
+
+type grant struct {
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIdP{key: key, codes: map[string]grant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                m.srv.URL,
+			"authorization_endpoint":                m.srv.URL + "/authorize",
+			"token_endpoint":                        m.srv.URL + "/token",
+			"jwks_uri":                              m.srv.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		b64 := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA", "alg": "RS256", "use": "sig", "kid": "k1",
+			"n": b64(key.N.Bytes()),
+			"e": b64(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if id, secret, _ := r.BasicAuth(); id != "eureka" || secret != "s3cret" {
+			http.Error(w, `{"error":"invalid_client"}`, 401)
+			return
+		}
+		m.mu.Lock()
+		g, ok := m.codes[r.Form.Get("code")]
+		delete(m.codes, r.Form.Get("code"))
+		m.mu.Unlock()
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss": m.srv.URL, "aud": "eureka", "sub": "user-1",
+			"iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix(),
+			"nonce": g.nonce,
+		}
+		for k, v := range g.claims {
+			claims[k] = v
+		}
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		tok.Header["kid"] = "k1"
+		idt, _ := tok.SignedString(key)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "at", "token_type": "Bearer", "expires_in": 60, "id_token": idt,
+		})
+	})
+	m.srv = httptest.NewServer(mux)
+	t.Cleanup(m.srv.Close)
+	return m
+}
+
+// authorize plays the user consenting at the IdP and returns the code the
+// IdP would pass to the callback.
+func (m *mockIdP) authorize(t *testing.T, authURL string, claims jwt.MapClaims) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("no PKCE challenge in %s", authURL)
+	}
+	g := grant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), claims: claims}
+	if n, ok := claims["nonce"].(string); ok {
+		g.nonce = n
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code := "code-" + q.Get("state")
+	m.codes[code] = g
+	return code
+}
+
+func TestLogin(t *testing.T) {
+	idp := newMockIdP(t)
+	ctx := context.Background()
+	p, err := New(ctx, Config{
+		Issuer:       idp.srv.URL,
+		ClientID:     "eureka",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://api.test/api/auth/oidc/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		want    Identity
+		wantErr bool
+	}{
+		{
+			name:   "verified email",
+			claims: jwt.MapClaims{"email": "ann@example.com", "email_verified": true},
+			want:   Identity{Subject: "user-1", Email: "ann@example.com", EmailVerified: true},
+		},
+		{
+			name:   "verified as string",
+			claims: jwt.MapClaims{"email": "ann@example.com", "email_verified": "true"},
+			want:   Identity{Subject: "user-1", Email: "ann@example.com", EmailVerified: true},
+		},
+		{
+			name:   "unverified email",
+			claims: jwt.MapClaims{"email": "ann@example.com"},
+			want:   Identity{Subject: "user-1", Email: "ann@example.com"},
+		},
+		{
+			name:    "wrong nonce",
+			claims:  jwt.MapClaims{"email": "ann@example.com", "nonce": "replayed"},
+			wantErr: true,
+		},
+		{
+			name:    "wrong audience",
+			claims:  jwt.MapClaims{"email": "ann@example.com", "aud": "someone-else"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, authURL, err := p.Start()
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := idp.authorize(t, authURL, tt.claims)
+			got, err := p.Finish(ctx, state, code)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Finish() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Finish() = %+v, want %+v", got, tt.want)
+			}
+			if _, err := p.Finish(ctx, state, code); err != ErrUnknownState {
+				t.Errorf("second Finish() error = %v, want ErrUnknownState", err)
+			}
+		})
+	}
+
+	t.Run("unknown state", func(t *testing.T) {
+		if _, err := p.Finish(ctx, "nope", "code"); err != ErrUnknownState {
+			t.Errorf("Finish() error = %v, want ErrUnknownState", err)
+		}
+	})
+}
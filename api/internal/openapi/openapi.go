@@ -0,0 +1,157 @@
+// Package openapi holds the OpenAPI 3 description of the HTTP API, serves
+// it as JSON and validates requests against it.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed openapi.yaml
+var source []byte
+
+// The document is parsed once; a broken file fails the package tests and
+// panics at startup.
+var doc, docJSON = mustLoad()
+
+type document struct {
+	Paths      map[string]map[string]*Operation `yaml:"paths"`
+	Components struct {
+		Schemas    map[string]*Schema    `yaml:"schemas"`
+		Parameters map[string]*Parameter `yaml:"parameters"`
+	} `yaml:"components"`
+}
+
+// Operation is the part of an operation that requests are checked against.
+type Operation struct {
+	ID          string       `yaml:"operationId"`
+	Parameters  []*Parameter `yaml:"parameters"`
+	RequestBody *struct {
+		Required bool `yaml:"required"`
+		Content  map[string]struct {
+			Schema *Schema `yaml:"schema"`
+		} `yaml:"content"`
+	} `yaml:"requestBody"`
+}
+
+type Parameter struct {
+	Ref      string  `yaml:"$ref"`
+	Name     string  `yaml:"name"`
+	In       string  `yaml:"in"`
+	Required bool    `yaml:"required"`
+	Schema   *Schema `yaml:"schema"`
+}
+
+// Schema is the subset of JSON Schema the document uses.
+type Schema struct {
+	Ref        string             `yaml:"$ref"`
+	Type       string             `yaml:"type"`
+	Format     string             `yaml:"format"`
+	Nullable   bool               `yaml:"nullable"`
+	Enum       []string           `yaml:"enum"`
+	Required   []string           `yaml:"required"`
+	Properties map[string]*Schema `yaml:"properties"`
+	Items      *Schema            `yaml:"items"`
+	MinLength  *int               `yaml:"minLength"`
+	MaxLength  *int               `yaml:"maxLength"`
+	Minimum    *float64           `yaml:"minimum"`
+	Maximum    *float64           `yaml:"maximum"`
+}
+
+func mustLoad() (*document, []byte) {
+	d, b, err := load(source)
+	if err != nil {
+		panic("openapi: " + err.Error())
+	}
+	return d, b
+}
+
+func load(src []byte) (*document, []byte, error) {
+	var raw any
+	if err := yaml.Unmarshal(src, &raw); err != nil {
+		return nil, nil, err
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	var d document
+	if err := yaml.Unmarshal(src, &d); err != nil {
+		return nil, nil, err
+	}
+	// Resolve parameter references up front and check schema references,
+	// so a typo shows up at load time rather than on some request.
+	for path, ops := range d.Paths {
+		for method, op := range ops {
+			for i, p := range op.Parameters {
+				if p.Ref == "" {
+					continue
+				}
+				q, ok := d.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+				if !ok {
+					return nil, nil, fmt.Errorf("%s %s: unknown parameter %s", method, path, p.Ref)
+				}
+				op.Parameters[i] = q
+			}
+		}
+	}
+	for _, r := range refs(raw) {
+		if name, ok := strings.CutPrefix(r, "#/components/schemas/"); ok {
+			if d.Components.Schemas[name] == nil {
+				return nil, nil, fmt.Errorf("unknown schema %s", r)
+			}
+		}
+	}
+	return &d, b, nil
+}
+
+// refs lists every $ref in a decoded document.
+func refs(v any) []string {
+	var out []string
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if s, ok := e.(string); ok && k == "$ref" {
+				out = append(out, s)
+				continue
+			}
+			out = append(out, refs(e)...)
+		}
+	case []any:
+		for _, e := range v {
+			out = append(out, refs(e)...)
+		}
+	}
+	return out
+}
+
+// Handler serves the document as JSON.
+func Handler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	_, _ = w.Write(docJSON)
+}
+
+// Lookup returns the operation for method on a route pattern such as
+// /api/pages/{id}, or nil when the document has none.
+func Lookup(method, pattern string) *Operation {
+	return doc.Paths[pattern][strings.ToLower(method)]
+}
+
+// Routes lists every operation as "METHOD /path", sorted.
+func Routes() []string {
+	var out []string
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			out = append(out, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
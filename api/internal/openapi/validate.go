@@ -0,0 +1,308 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// MaxJSONBody caps the JSON bodies Validate reads; larger ones get 413.
+const MaxJSONBody = 1 << 20
+
+var errTooLarge = errors.New("body too large")
+
+// Validate checks the path and query parameters and the JSON body of each
+// request against its operation and answers 400 with the first problem.
+// Requests that routes does not match, or whose route has no operation,
+// pass through. Object properties are matched case-insensitively and
+// unknown ones are ignored, as encoding/json does when handlers decode
+// them.
+//
+// Install it after authentication on protected routes, so anonymous
+// callers never get their bodies read or learn about the schema.
+func Validate(routes chi.Routes) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rc := chi.NewRouteContext()
+			if !routes.Match(rc, r.Method, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			op := Lookup(r.Method, rc.RoutePattern())
+			if op == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err := op.checkParams(r, rc); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := op.checkBody(w, r); err != nil {
+				code := http.StatusBadRequest
+				if errors.Is(err, errTooLarge) {
+					code = http.StatusRequestEntityTooLarge
+				}
+				http.Error(w, err.Error(), code)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (op *Operation) checkParams(r *http.Request, rc *chi.Context) error {
+	q := r.URL.Query()
+	for _, p := range op.Parameters {
+		var v string
+		var ok bool
+		switch p.In {
+		case "path":
+			v, ok = rc.URLParam(p.Name), true
+		case "query":
+			ok = q.Has(p.Name)
+			v = q.Get(p.Name)
+		default:
+			continue
+		}
+		if !ok {
+			if p.Required {
+				return fmt.Errorf("%s: required", p.Name)
+			}
+			continue
+		}
+		if err := checkParam(p.Schema, v); err != nil {
+			return fmt.Errorf("%s: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// checkParam checks a path or query value, which is always a string on
+// the wire.
+func checkParam(s *Schema, v string) error {
+	s = resolve(s)
+	switch s.Type {
+	case "integer":
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		return checkRange(s, float64(n))
+	case "boolean":
+		if v != "true" && v != "false" {
+			return errors.New("must be true or false")
+		}
+		return nil
+	}
+	return checkString(s, v)
+}
+
+func (op *Operation) checkBody(w http.ResponseWriter, r *http.Request) error {
+	if op.RequestBody == nil {
+		return nil
+	}
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if _, ok := op.RequestBody.Content["multipart/form-data"]; ok {
+		if ct != "multipart/form-data" {
+			return errors.New("body must be multipart/form-data")
+		}
+		return nil
+	}
+	media, ok := op.RequestBody.Content["application/json"]
+	if !ok || media.Schema == nil {
+		return nil
+	}
+	// Clients have always been able to omit the JSON content type, so only
+	// a different one is refused.
+	if ct != "" && ct != "application/json" {
+		return errors.New("body must be application/json")
+	}
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxJSONBody))
+	if err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return errTooLarge
+		}
+		return errors.New("bad json")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	if len(bytes.TrimSpace(b)) == 0 {
+		if op.RequestBody.Required {
+			return errors.New("body required")
+		}
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return errors.New("bad json")
+	}
+	if err := check(media.Schema, v); err != nil {
+		return fmt.Errorf("body%w", err)
+	}
+	return nil
+}
+
+func resolve(s *Schema) *Schema {
+	for s.Ref != "" {
+		s = doc.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	return s
+}
+
+// pathError is a problem at a place in the body, such as .tags[2].
+type pathError struct {
+	path string
+	msg  string
+}
+
+func (e *pathError) Error() string { return e.path + ": " + e.msg }
+
+func at(prefix string, err error) error {
+	var pe *pathError
+	if errors.As(err, &pe) {
+		return &pathError{prefix + pe.path, pe.msg}
+	}
+	return &pathError{prefix, err.Error()}
+}
+
+// check validates a decoded JSON value.
+func check(s *Schema, v any) error {
+	s = resolve(s)
+	if v == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return &pathError{"", "must not be null"}
+	}
+	switch s.Type {
+	case "object":
+		m, ok := v.(map[string]any)
+		if !ok {
+			return &pathError{"", "must be an object"}
+		}
+		for _, name := range s.Required {
+			if _, ok := field(m, name); !ok {
+				return &pathError{"." + name, "required"}
+			}
+		}
+		for name, ps := range s.Properties {
+			if fv, ok := field(m, name); ok {
+				if err := check(ps, fv); err != nil {
+					return at("."+name, err)
+				}
+			}
+		}
+	case "array":
+		a, ok := v.([]any)
+		if !ok {
+			return &pathError{"", "must be an array"}
+		}
+		for i, e := range a {
+			if err := check(s.Items, e); err != nil {
+				return at("["+strconv.Itoa(i)+"]", err)
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return &pathError{"", "must be a string"}
+		}
+		if err := checkString(s, str); err != nil {
+			return &pathError{"", err.Error()}
+		}
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return &pathError{"", "must be an integer"}
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return &pathError{"", "must be an integer"}
+		}
+		if err := checkRange(s, float64(i)); err != nil {
+			return &pathError{"", err.Error()}
+		}
+	case "number":
+		n, ok := v.(json.Number)
+		if !ok {
+			return &pathError{"", "must be a number"}
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return &pathError{"", "must be a number"}
+		}
+		if err := checkRange(s, f); err != nil {
+			return &pathError{"", err.Error()}
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return &pathError{"", "must be true or false"}
+		}
+	}
+	return nil
+}
+
+// field finds a property the way encoding/json does: an exact match first,
+// then a case-insensitive one.
+func field(m map[string]any, name string) (any, bool) {
+	if v, ok := m[name]; ok {
+		return v, true
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func checkString(s *Schema, v string) error {
+	if s.Enum != nil && !slices.Contains(s.Enum, v) {
+		return fmt.Errorf("must be one of %s", strings.Join(s.Enum, ", "))
+	}
+	n := utf8.RuneCountInString(v)
+	if s.MinLength != nil && n < *s.MinLength {
+		if *s.MinLength == 1 {
+			return errors.New("must not be empty")
+		}
+		return fmt.Errorf("must be at least %d characters", *s.MinLength)
+	}
+	if s.MaxLength != nil && n > *s.MaxLength {
+		return fmt.Errorf("must be at most %d characters", *s.MaxLength)
+	}
+	switch s.Format {
+	case "uuid":
+		if _, err := uuid.Parse(v); err != nil {
+			return errors.New("must be a UUID")
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, v); err != nil {
+			return errors.New("must be an RFC 3339 time")
+		}
+	}
+	return nil
+}
+
+func checkRange(s *Schema, v float64) error {
+	if s.Minimum != nil && v < *s.Minimum {
+		return fmt.Errorf("must be at least %v", *s.Minimum)
+	}
+	if s.Maximum != nil && v > *s.Maximum {
+		return fmt.Errorf("must be at most %v", *s.Maximum)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package openapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// TestValidateParams covers query parameters on routes that the router
+// only validates behind authentication.
+func TestValidateParams(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Validate(r))
+	ok := func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(204) }
+	r.Get("/api/admin/audit", ok)
+	r.Get("/api/tags/pages", ok)
+	for _, tc := range []struct {
+		path string
+		code int
+		want string
+	}{
+		{"/api/admin/audit?limit=5000", 400, "limit: must be at most 1000"},
+		{"/api/admin/audit?limit=ten", 400, "limit: must be an integer"},
+		{"/api/admin/audit?since=yesterday", 400, "since: must be an RFC 3339 time"},
+		{"/api/admin/audit?limit=10&since=2024-01-02T03:04:05Z", 204, ""},
+		{"/api/tags/pages", 400, "tag: required"},
+		{"/api/tags/pages?tag=go", 204, ""},
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", tc.path, nil))
+		if got := strings.TrimSpace(rec.Body.String()); rec.Code != tc.code || got != tc.want {
+			t.Errorf("%s: got %d %q, want %d %q", tc.path, rec.Code, got, tc.code, tc.want)
+		}
+	}
+}
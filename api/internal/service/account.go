@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/tim/eureka/internal/auth"
+	"github.com/tim/eureka/internal/db"
+	"github.com/tim/eureka/internal/validate"
+)
+
+// TokensRevokedAt implements auth.RevokedAtFunc. Disabled users have no
+// row, so all their tokens are rejected.
+func (s *Service) TokensRevokedAt(ctx context.Context, uid string) (time.Time, error) {
+	id, err := uuid.Parse(uid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return s.Q.UserRevokedAt(ctx, id)
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// currentUser loads the caller's account.
+func (s *Service) currentUser(w http.ResponseWriter, r *http.Request) (db.User, bool) {
+	uidStr := r.Context().Value(auth.CtxUserID).(string)
+	uid, err := uuid.Parse(uidStr)
+	if err != nil {
+		http.Error(w, "bad uid", 400)
+		return db.User{}, false
+	}
+	u, err := s.Q.UserByID(r.Context(), uid)
+	if err != nil {
+		http.Error(w, "not found", 404)
+		return db.User{}, false
+	}
+	return u, true
+}
+
+func (s *Service) Me(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, r, map[string]any{
+		"id":          u.ID.String(),
+		"email":       u.Email,
+		"role":        string(u.Role),
+		"permissions": auth.Permissions(string(u.Role)),
+	})
+}
+
+func (s *Service) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		CurrentPassword string
+		NewPassword     string
+	}
+	if !bind(w, r, &req) {
+		return
+	}
+	u, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if !check(r.Context(), u.PassHash, req.CurrentPassword) {
+		http.Error(w, "wrong password", 403)
+		return
+	}
+	if err := s.Passwords.Check(req.NewPassword, u.Email); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	h, err := hash(r.Context(), req.NewPassword)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if err := s.Q.UserSetPassword(r.Context(), db.UserSetPasswordParams{
+		Column1:  u.ID,
+		PassHash: h,
+	}); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writeJSON(w, r, map[string]string{"ok": "1"})
+}
+
+func (s *Service) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email           string
+		CurrentPassword string
+	}
+	if !bind(w, r, &req) {
+		return
+	}
+	u, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if !check(r.Context(), u.PassHash, req.CurrentPassword) {
+		http.Error(w, "wrong password", 403)
+		return
+	}
+	email, err := validate.Email(req.Email)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	if err := s.Q.UserSetEmail(r.Context(), db.UserSetEmailParams{
+		Column1:         u.ID,
+		Email:           email,
+		EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: !s.VerifyEmail},
+	}); err != nil {
+		if isUniqueViolation(err) {
+			http.Error(w, "email taken", 409)
+			return
+		}
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	_ = s.Q.VerificationsDeleteByUser(r.Context(), u.ID)
+	if s.VerifyEmail {
+		s.sendVerification(r.Context(), u.ID, email)
+	}
+	writeJSON(w, r, map[string]string{"ok": "1"})
+}
+
+// DeleteMe deletes the caller's account together with their pages. Its
+// tokens stop working because the middleware can no longer find the user.
+func (s *Service) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string
+	}
+	if !bind(w, r, &req) {
+		return
+	}
+	u, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if !check(r.Context(), u.PassHash, req.Password) {
+		http.Error(w, "wrong password", 403)
+		return
+	}
+	err := s.inTx(r.Context(), func(q *db.Queries) error {
+		if err := q.PagesDeleteByUser(r.Context(), u.ID); err != nil {
+			return err
+		}
+		return q.UserDelete(r.Context(), u.ID)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writeJSON(w, r, map[string]string{"ok": "1"})
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tim/eureka/internal/auth"
+	"github.com/tim/eureka/internal/db"
+	"github.com/tim/eureka/internal/middleware"
+)
+
+const (
+	auditPageSize   = 100
+	auditMaxPage    = 1000
+	auditExportPage = 1000
+)
+
+// audit records a privileged action by the caller in the audit log. before
+// and after describe the target around the action; either may be nil. The
+// action has already happened, so a failure to record it is only logged.
+func (s *Service) audit(r *http.Request, action, targetType, targetID string, before, after any) {
+	var actor uuid.NullUUID
+	uidStr, _ := r.Context().Value(auth.CtxUserID).(string)
+	if uid, err := uuid.Parse(uidStr); err == nil {
+		actor = uuid.NullUUID{UUID: uid, Valid: true}
+	}
+	b, err := json.Marshal(before)
+	if err != nil {
+		middleware.Log(r.Context()).Error("audit", "action", action, "err", err)
+		return
+	}
+	a, err := json.Marshal(after)
+	if err != nil {
+		middleware.Log(r.Context()).Error("audit", "action", action, "err", err)
+		return
+	}
+	if err := s.Q.AuditEventCreate(r.Context(), db.AuditEventCreateParams{
+		ActorID:    actor,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		RequestID:  middleware.GetRequestID(r.Context()),
+		Ip:         s.ClientIP(r),
+		Before:     b,
+		After:      a,
+	}); err != nil {
+		middleware.Log(r.Context()).Error("audit", "action", action, "err", err)
+	}
+}
+
+// auditFilter reads the filters shared by AdminAudit and AdminAuditExport:
+// action (exact, or a prefix such as "user"), actor, target, and since and
+// until as RFC 3339 times.
+func auditFilter(r *http.Request) (db.AuditEventsListParams, bool) {
+	q := r.URL.Query()
+	f := db.AuditEventsListParams{
+		Action: q.Get("action"),
+		Actor:  q.Get("actor"),
+		Target: q.Get("target"),
+	}
+	for _, t := range []struct {
+		key string
+		dst *sql.NullTime
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		v := q.Get(t.key)
+		if v == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, false
+		}
+		*t.dst = sql.NullTime{Time: at, Valid: true}
+	}
+	return f, true
+}
+
+// AdminAudit lists audit events, newest first. Pass the returned next value
+// as ?before= for the following page.
+func (s *Service) AdminAudit(w http.ResponseWriter, r *http.Request) {
+	f, ok := auditFilter(r)
+	if !ok {
+		http.Error(w, "since and until must be RFC 3339 times", 400)
+		return
+	}
+	f.Lim = auditPageSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > auditMaxPage {
+			http.Error(w, "bad limit", 400)
+			return
+		}
+		f.Lim = int32(n)
+	}
+	if v := r.URL.Query().Get("before"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 {
+			http.Error(w, "bad before", 400)
+			return
+		}
+		f.BeforeID = n
+	}
+	rows, err := s.Q.AuditEventsList(r.Context(), f)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	var next int64
+	if len(rows) == int(f.Lim) {
+		next = rows[len(rows)-1].ID
+	}
+	if rows == nil {
+		rows = []db.AuditEvent{}
+	}
+	writeJSON(w, r, map[string]any{"events": rows, "next": next})
+}
+
+// AdminAuditExport streams every matching event as CSV or, with
+// ?format=jsonl, as one JSON object per line.
+func (s *Service) AdminAuditExport(w http.ResponseWriter, r *http.Request) {
+	f, ok := auditFilter(r)
+	if !ok {
+		http.Error(w, "since and until must be RFC 3339 times", 400)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "jsonl" {
+		http.Error(w, "format must be csv or jsonl", 400)
+		return
+	}
+	f.Lim = auditExportPage
+	// Read the first page before writing headers, so a database error can
+	// still be reported with a status code.
+	rows, err := s.Q.AuditEventsList(r.Context(), f)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	name := "audit-" + time.Now().UTC().Format("20060102") + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	var write func(db.AuditEvent) error
+	var flush func() error
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"id", "at", "actor_id", "actor_email", "action", "target_type", "target_id", "request_id", "ip", "before", "after"})
+		write = func(e db.AuditEvent) error {
+			actor := ""
+			if e.ActorID.Valid {
+				actor = e.ActorID.UUID.String()
+			}
+			return cw.Write([]string{
+				strconv.FormatInt(e.ID, 10), e.At.UTC().Format(time.RFC3339Nano), actor, e.ActorEmail,
+				e.Action, e.TargetType, e.TargetID, e.RequestID, e.Ip, string(e.Before), string(e.After),
+			})
+		}
+		flush = func() error { cw.Flush(); return cw.Error() }
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		write = func(e db.AuditEvent) error { return enc.Encode(e) }
+		flush = func() error { return nil }
+	}
+
+	for {
+		for _, e := range rows {
+			if err := write(e); err != nil {
+				return
+			}
+		}
+		if err := flush(); err != nil || len(rows) < auditExportPage {
+			return
+		}
+		f.BeforeID = rows[len(rows)-1].ID
+		if rows, err = s.Q.AuditEventsList(r.Context(), f); err != nil {
+			middleware.Log(r.Context()).Error("audit export", "err", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/tim/eureka/internal/db"
+	apperr "github.com/tim/eureka/internal/errors"
+	"github.com/tim/eureka/internal/wiki"
+)
+
+// What happens to a deleted user's pages.
+const (
+	deleteTransfer = "transfer" // re-owned by another user
+	deleteArchive  = "archive"  // moved to the archive tables
+	deletePurge    = "purge"    // deleted with links, tags and images
+)
+
+var errBadDeletion = apperr.New("bad_deletion", "mode must be transfer, archive or purge", http.StatusBadRequest)
+
+// pageRename is a page renamed on transfer because the new owner already
+// has a page with that name.
+type pageRename struct {
+	ID   uuid.UUID `json:"id"`
+	From string    `json:"from"`
+	To   string    `json:"to"`
+}
+
+// deletionPlan is what deleting a user will do. Confirm is a digest of the
+// plan: the delete request must send it back, so nothing is removed that
+// differs from what the admin saw in the preview.
+type deletionPlan struct {
+	UserID        uuid.UUID    `json:"userId"`
+	Email         string       `json:"email"`
+	Mode          string       `json:"mode"`
+	TransferTo    *uuid.UUID   `json:"transferTo,omitempty"`
+	Pages         int64        `json:"pages"`
+	Trashed       int64        `json:"trashed"` // pages in the trash; purged unless archived
+	Links         int64        `json:"links"`
+	Images        int64        `json:"images"`
+	IncomingLinks int64        `json:"incomingLinks"` // from other users' pages; lost unless transferred
+	Renames       []pageRename `json:"renames"`
+	Confirm       string       `json:"confirm"`
+
+	pages []db.PagesContentByUserRow
+}
+
+func (s *Service) planDeletion(ctx context.Context, u db.User, mode, to string) (deletionPlan, error) {
+	p := deletionPlan{UserID: u.ID, Email: u.Email, Mode: mode, Renames: []pageRename{}}
+	switch mode {
+	case deleteTransfer:
+		id, err := uuid.Parse(to)
+		if err != nil {
+			return p, errBadDeletion.WithMessage("bad transfer target")
+		}
+		if id == u.ID {
+			return p, errBadDeletion.WithMessage("cannot transfer pages to the deleted user")
+		}
+		if _, err := s.Q.UserByID(ctx, id); err != nil {
+			return p, apperr.ErrNotFound.WithMessage("transfer target not found")
+		}
+		p.TransferTo = &id
+	case deleteArchive, deletePurge:
+	default:
+		return p, errBadDeletion
+	}
+
+	counts, err := s.Q.UserContentCounts(ctx, u.ID)
+	if err != nil {
+		return p, err
+	}
+	p.Pages, p.Trashed, p.Links, p.Images, p.IncomingLinks = counts.Pages, counts.Trashed, counts.Links, counts.Images, counts.IncomingLinks
+	if p.pages, err = s.Q.PagesContentByUser(ctx, u.ID); err != nil {
+		return p, err
+	}
+	parts := []string{mode, fmt.Sprint(p.Trashed, p.Links, p.Images)}
+	if p.TransferTo != nil {
+		if p.Renames, err = s.transferRenames(ctx, u, *p.TransferTo, p.pages); err != nil {
+			return p, err
+		}
+		parts = append(parts, p.TransferTo.String())
+	}
+	for _, pg := range p.pages {
+		parts = append(parts, pg.ID.String()+" "+pg.Name)
+	}
+	p.Confirm = hashSecret(strings.Join(parts, "\n"))[:16]
+	return p, nil
+}
+
+// transferRenames picks a new name for each page whose name the new owner
+// already uses, so wiki links keep resolving to the right page. The new
+// name is "Name (user)", numbered if that is taken too.
+func (s *Service) transferRenames(ctx context.Context, u db.User, to uuid.UUID, pages []db.PagesContentByUserRow) ([]pageRename, error) {
+	theirs, err := s.Q.PagesByUser(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+	clash := map[string]bool{}
+	taken := map[string]bool{}
+	for _, p := range theirs {
+		clash[p.Name], taken[p.Name] = true, true
+	}
+	for _, p := range pages {
+		taken[p.Name] = true
+	}
+	who, _, _ := strings.Cut(u.Email, "@")
+	renames := []pageRename{}
+	for _, p := range pages {
+		if !clash[p.Name] {
+			continue
+		}
+		name := fmt.Sprintf("%s (%s)", p.Name, who)
+		for n := 2; taken[name]; n++ {
+			name = fmt.Sprintf("%s (%s %d)", p.Name, who, n)
+		}
+		taken[name] = true
+		renames = append(renames, pageRename{ID: p.ID, From: p.Name, To: name})
+	}
+	return renames, nil
+}
+
+func deletionError(w http.ResponseWriter, err error) {
+	var ae *apperr.AppError
+	if errors.As(err, &ae) {
+		http.Error(w, ae.Message, ae.Status)
+		return
+	}
+	http.Error(w, err.Error(), 500)
+}
+
+// AdminUserDeletionPreview shows what deleting a user with ?mode= (and ?to=
+// for transfers) would do, with the confirm code AdminDeleteUser needs.
+func (s *Service) AdminUserDeletionPreview(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.targetUser(w, r)
+	if !ok {
+		return
+	}
+	p, err := s.planDeletion(r.Context(), u, r.URL.Query().Get("mode"), r.URL.Query().Get("to"))
+	if err != nil {
+		deletionError(w, err)
+		return
+	}
+	writeJSON(w, r, p)
+}
+
+// AdminDeleteUser deletes a user and transfers, archives or purges their
+// pages. Confirm must match a preview of the same deletion; if the user's
+// pages changed since, the admin has to preview again.
+func (s *Service) AdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Mode       string
+		TransferTo string
+		Confirm    string
+	}
+	if !bind(w, r, &req) {
+		return
+	}
+	u, ok := s.targetUser(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	p, err := s.planDeletion(ctx, u, req.Mode, req.TransferTo)
+	if err != nil {
+		deletionError(w, err)
+		return
+	}
+	if req.Confirm == "" || req.Confirm != p.Confirm {
+		http.Error(w, "confirm does not match the current preview", 409)
+		return
+	}
+
+	renamed := map[uuid.UUID]string{}
+	names := map[string]string{}
+	for _, rn := range p.Renames {
+		renamed[rn.ID] = rn.To
+		if _, ok := names[rn.From]; !ok {
+			names[rn.From] = rn.To
+		}
+	}
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		switch p.Mode {
+		case deleteTransfer:
+			if _, err := q.PagesPurgeTrashByUser(ctx, u.ID); err != nil {
+				return err
+			}
+			for i, pg := range p.pages {
+				name, renamedPage := renamed[pg.ID]
+				if !renamedPage {
+					name = pg.Name
+				}
+				body, changed := wiki.RenameLinks(pg.Body, names)
+				if renamedPage || changed {
+					if err := q.PageUpdate(ctx, db.PageUpdateParams{Column1: pg.ID, Name: name, Body: body}); err != nil {
+						return err
+					}
+					p.pages[i].Body = body
+				}
+				if err := q.PageSetOwner(ctx, db.PageSetOwnerParams{Column1: pg.ID, Column2: *p.TransferTo}); err != nil {
+					return err
+				}
+			}
+		case deleteArchive:
+			if err := q.PagesArchiveByUser(ctx, u.ID); err != nil {
+				return err
+			}
+			if err := q.ImagesArchiveByUser(ctx, u.ID); err != nil {
+				return err
+			}
+			if err := q.PagesDeleteByUser(ctx, u.ID); err != nil {
+				return err
+			}
+		case deletePurge:
+			if err := q.PagesDeleteByUser(ctx, u.ID); err != nil {
+				return err
+			}
+		}
+		return q.UserDelete(ctx, u.ID)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if p.Mode == deleteTransfer {
+		// Names now resolve among the new owner's pages.
+		for _, pg := range p.pages {
+			_ = s.syncPageLinks(ctx, pg.ID, *p.TransferTo, pg.Body)
+		}
+	}
+	s.audit(r, "user.delete", "user", u.ID.String(),
+		map[string]any{"email": u.Email, "role": u.Role, "pages": p.Pages, "links": p.Links, "images": p.Images},
+		map[string]any{"mode": p.Mode, "transferTo": p.TransferTo, "renames": p.Renames})
+	writeJSON(w, r, map[string]any{"ok": "1", "mode": p.Mode, "pages": p.Pages, "renames": p.Renames})
+}
+
+// AdminArchivedPages lists the pages archived when their owners were
+// deleted.
+func (s *Service) AdminArchivedPages(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.Q.ArchivedPagesList(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writeJSON(w, r, rows)
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/tim/eureka/internal/db"
+	apperr "github.com/tim/eureka/internal/errors"
+	"github.com/tim/eureka/internal/metrics"
+	"github.com/tim/eureka/internal/middleware"
+	"github.com/tim/eureka/internal/throttle"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// LoginLimits configures brute-force protection for Login. Nil limiters and
+// a zero LockAfter disable the corresponding check.
+type LoginLimits struct {
+	PerIP      *throttle.Limiter
+	PerAccount *throttle.Limiter // keyed by the normalized email
+
+	LockAfter int           // failed logins that lock the account
+	LockFor   time.Duration // how long the lock lasts
+
+	TrustProxy bool // take the client IP from X-Real-IP / X-Forwarded-For
+}
+
+// ThrottledError is returned by Login while the client or the account has to
+// wait. Locked accounts get the same error, so it does not reveal whether
+// an account exists.
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string { return "too many login attempts" }
+
+var (
+	ErrBadCredentials  = errors.New("bad credentials")
+	ErrAccountDisabled = apperr.New("account_disabled", "account disabled", http.StatusForbidden)
+)
+
+// dummyHash is compared against when the email is unknown, so that a
+// failed login takes the same time either way.
+var dummyHash = sync.OnceValue(func() string {
+	h, _ := bcrypt.GenerateFromPassword([]byte("eureka-dummy-password"), bcrypt.DefaultCost)
+	return string(h)
+})
+
+func (s *Service) Login(ctx context.Context, ip, email, password string) (string, string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	l := s.Limits
+	if d := max(wait(l.PerIP, ip), wait(l.PerAccount, email)); d > 0 {
+		metrics.LoginFailures.WithLabelValues("throttled").Inc()
+		return "", "", &ThrottledError{RetryAfter: d}
+	}
+
+	u, err := s.Q.UserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		check(ctx, dummyHash(), password)
+		s.loginFailed(ctx, ip, email, uuid.Nil, "password")
+		return "", "", ErrBadCredentials
+	}
+	if err != nil {
+		return "", "", err
+	}
+	ok := check(ctx, u.PassHash, password)
+	if u.LockedUntil.Valid && time.Now().Before(u.LockedUntil.Time) {
+		if !ok {
+			s.loginFailed(ctx, ip, email, uuid.Nil, "throttled")
+		} else {
+			metrics.LoginFailures.WithLabelValues("throttled").Inc()
+		}
+		return "", "", &ThrottledError{RetryAfter: time.Until(u.LockedUntil.Time)}
+	}
+	if !ok {
+		s.loginFailed(ctx, ip, email, u.ID, "password")
+		return "", "", ErrBadCredentials
+	}
+
+	if u.DisabledAt.Valid {
+		return "", "", ErrAccountDisabled
+	}
+	if s.VerifyEmail && !u.EmailVerifiedAt.Valid {
+		return "", "", ErrEmailNotVerified
+	}
+	if u.TotpEnabledAt.Valid {
+		// The failure counters are only reset once the second step passes.
+		return u.ID.String(), string(u.Role), ErrTwoFactorRequired
+	}
+	s.loginSucceeded(ctx, email, u.ID)
+	return u.ID.String(), string(u.Role), nil
+}
+
+func (s *Service) loginSucceeded(ctx context.Context, email string, uid uuid.UUID) {
+	middleware.AddLogAttrs(ctx, "user_id", uid)
+	if s.Limits.PerAccount != nil {
+		s.Limits.PerAccount.Reset(email)
+	}
+	if err := s.Q.UserLoginSucceeded(ctx, uid); err != nil {
+		middleware.Log(ctx).Error("login succeeded", "user_id", uid, "err", err)
+	}
+}
+
+func wait(l *throttle.Limiter, key string) time.Duration {
+	if l == nil || key == "" {
+		return 0
+	}
+	return l.Wait(key)
+}
+
+// loginFailed counts a failure against the IP, the email and, for an
+// existing account, its lockout counter. reason labels the failure in the
+// login failure metric.
+func (s *Service) loginFailed(ctx context.Context, ip, email string, uid uuid.UUID, reason string) {
+	metrics.LoginFailures.WithLabelValues(reason).Inc()
+	l := s.Limits
+	if l.PerIP != nil && ip != "" {
+		l.PerIP.Fail(ip)
+	}
+	if l.PerAccount != nil {
+		l.PerAccount.Fail(email)
+	}
+	if uid == uuid.Nil || l.LockAfter <= 0 {
+		return
+	}
+	until, err := s.Q.UserLoginFailed(ctx, db.UserLoginFailedParams{
+		Column1: uid,
+		Column2: int32(l.LockAfter),
+		Column3: time.Now().Add(l.LockFor),
+	})
+	if err != nil {
+		middleware.Log(ctx).Error("login failed", "user_id", uid, "err", err)
+		return
+	}
+	if until.Valid && time.Now().Before(until.Time) {
+		middleware.Log(ctx).Warn("account locked", "user_id", uid, "until", until.Time)
+	}
+}
+
+// ClientIP returns the address Login throttles by.
+func (s *Service) ClientIP(r *http.Request) string {
+	if s.Limits.TrustProxy {
+		if ip := r.Header.Get("X-Real-IP"); ip != "" {
+			return strings.TrimSpace(ip)
+		}
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			first, _, _ := strings.Cut(xff, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (s *Service) AdminLockedUsers(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.Q.UsersLocked(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writeJSON(w, r, rows)
+}
+
+func (s *Service) AdminUnlockUser(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	uid, err := uuid.Parse(idStr)
+	if err != nil {
+		http.Error(w, "bad id", 400)
+		return
+	}
+	u, err := s.Q.UserByID(r.Context(), uid)
+	if err != nil {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if err := s.Q.UserUnlock(r.Context(), uid); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if s.Limits.PerAccount != nil {
+		s.Limits.PerAccount.Reset(strings.ToLower(u.Email))
+	}
+	s.audit(r, "user.unlock", "user", uid.String(), map[string]any{"failedLogins": u.FailedLogins, "locked": u.LockedUntil.Valid}, nil)
+	writeJSON(w, r, map[string]string{"ok": "1"})
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/tim/eureka/internal/auth"
+	"github.com/tim/eureka/internal/db"
+	apperr "github.com/tim/eureka/internal/errors"
+	"github.com/tim/eureka/internal/mail"
+	"github.com/tim/eureka/internal/middleware"
+	"github.com/tim/eureka/internal/validate"
+)
+
+// Registration modes.
+const (
+	RegistrationOpen   = "open"
+	RegistrationInvite = "invite"
+	RegistrationClosed = "closed"
+)
+
+const verifyTTL = 48 * time.Hour
+
+var (
+	ErrRegistrationClosed = apperr.New("registration_closed", "registration is closed", http.StatusForbidden)
+	ErrInviteRequired     = apperr.New("invite_required", "a valid invite code is required", http.StatusForbidden)
+	ErrEmailTaken         = apperr.New("email_taken", "email already registered", http.StatusConflict)
+	ErrEmailNotVerified   = apperr.New("email_not_verified", "email not verified", http.StatusForbidden)
+)
+
+func (s *Service) Register(ctx context.Context, email, password, invite string) (string, error) {
+	if s.Registration == RegistrationClosed {
+		return "", ErrRegistrationClosed
+	}
+	email, err := validate.Email(email)
+	if err != nil {
+		return "", apperr.ErrBadRequest.WithMessage(err.Error())
+	}
+	if err := s.Passwords.Check(password, email); err != nil {
+		return "", apperr.ErrBadRequest.WithMessage(err.Error())
+	}
+	h, err := hash(ctx, password)
+	if err != nil {
+		return "", err
+	}
+
+	var id string
+	err = s.inTx(ctx, func(q *db.Queries) error {
+		var inviteID uuid.UUID
+		if s.Registration == RegistrationInvite {
+			if inviteID, err = q.InviteUse(ctx, hashSecret(strings.TrimSpace(invite))); err != nil {
+				return ErrInviteRequired
+			}
+		}
+		id, err = q.UserCreate(ctx, db.UserCreateParams{
+			Email:           email,
+			PassHash:        h,
+			EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: !s.VerifyEmail},
+		})
+		if isUniqueViolation(err) {
+			return ErrEmailTaken
+		}
+		if err != nil || inviteID == uuid.Nil {
+			return err
+		}
+		return q.InviteSetUsedBy(ctx, db.InviteSetUsedByParams{Column1: inviteID, Column2: uuid.MustParse(id)})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if s.VerifyEmail {
+		s.sendVerification(ctx, uuid.MustParse(id), email)
+	}
+	return id, nil
+}
+
+// sendVerification mails a link that confirms email for user uid.
+func (s *Service) sendVerification(ctx context.Context, uid uuid.UUID, email string) {
+	lg := middleware.Log(ctx)
+	tok, h, err := newSecret()
+	if err != nil {
+		lg.Error("email verification", "err", err)
+		return
+	}
+	if err := s.Q.VerificationCreate(ctx, db.VerificationCreateParams{
+		Column1:   uid,
+		TokenHash: h,
+		ExpiresAt: time.Now().Add(verifyTTL),
+	}); err != nil {
+		lg.Error("email verification", "err", err)
+		return
+	}
+	link := strings.TrimRight(s.AppURL, "/") + "/verify-email?token=" + url.QueryEscape(tok)
+	msg := mail.Message{
+		To:      email,
+		Subject: "Eureka: подтверждение email",
+		Body:    "Чтобы подтвердить адрес, откройте ссылку:\n\n" + link + "\n",
+	}
+	go func() {
+		if err := s.mailer().Send(context.Background(), msg); err != nil {
+			lg.Error("email verification mail", "err", err)
+		}
+	}()
+}
+
+func (s *Service) VerifyEmailToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string
+	}
+	if !bind(w, r, &req) {
+		return
+	}
+	uid, err := s.Q.VerificationUse(r.Context(), hashSecret(req.Token))
+	if err != nil {
+		http.Error(w, "invalid or expired token", 400)
+		return
+	}
+	if err := s.Q.UserSetEmailVerified(r.Context(), uid); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writeJSON(w, r, map[string]string{"ok": "1"})
+}
+
+// ResendVerification mails a new verification link. Like ForgotPassword, it
+// does not reveal whether the account exists.
+func (s *Service) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string
+	}
+	if !bind(w, r, &req) {
+		return
+	}
+	defer writeJSON(w, r, map[string]string{"ok": "1"})
+	if !s.VerifyEmail {
+		return
+	}
+	u, err := s.Q.UserByEmail(r.Context(), strings.TrimSpace(req.Email))
+	if err != nil || u.EmailVerifiedAt.Valid {
+		return
+	}
+	s.sendVerification(r.Context(), u.ID, u.Email)
+}
+
+func (s *Service) AdminCreateInvite(w http.ResponseWriter, r *http.Request) {
+	uidStr := r.Context().Value(auth.CtxUserID).(string)
+	uid, err := uuid.Parse(uidStr)
+	if err != nil {
+		http.Error(w, "bad uid", 400)
+		return
+	}
+	var req struct {
+		Note           string
+		ExpiresInHours int
+	}
+	if !bind(w, r, &req) {
+		return
+	}
+	code, h, err := newSecret()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	var exp sql.NullTime
+	if req.ExpiresInHours > 0 {
+		exp = sql.NullTime{Time: time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour), Valid: true}
+	}
+	id, err := s.Q.InviteCreate(r.Context(), db.InviteCreateParams{
+		CodeHash:  h,
+		Note:      req.Note,
+		Column3:   uid,
+		ExpiresAt: exp,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	s.audit(r, "invite.create", "invite", id, nil, map[string]any{"note": req.Note, "expiresInHours": req.ExpiresInHours})
+	writeJSONCode(w, r, 201, map[string]string{"id": id, "code": code})
+}
+
+func (s *Service) AdminInvites(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.Q.InvitesList(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writeJSON(w, r, rows)
+}
+
+func (s *Service) AdminDeleteInvite(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		http.Error(w, "bad id", 400)
+		return
+	}
+	if err := s.Q.InviteDelete(r.Context(), id); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	s.audit(r, "invite.delete", "invite", id.String(), nil, nil)
+	writeJSON(w, r, map[string]string{"ok": "1"})
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/tim/eureka/internal/wiki"
+)
+
+const renderCacheSize = 1024
+
+// renderCache holds rendered pages. An entry is valid while the page's
+// updated_at is unchanged and the owner's set of pages, which wiki links
+// and embeds resolve against, has not changed either.
+type renderCache struct {
+	mu sync.Mutex
+	m  map[uuid.UUID]renderEntry
+}
+
+type renderEntry struct {
+	updatedAt time.Time
+	pages     string
+	html      string
+}
+
+func (c *renderCache) get(id uuid.UUID, updatedAt time.Time, pages string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.m[id]
+	if !ok || !e.updatedAt.Equal(updatedAt) || e.pages != pages {
+		return "", false
+	}
+	return e.html, true
+}
+
+func (c *renderCache) put(id uuid.UUID, e renderEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.m == nil || len(c.m) >= renderCacheSize {
+		c.m = make(map[uuid.UUID]renderEntry)
+	}
+	c.m[id] = e
+}
+
+func (s *Service) RenderPage(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	pid, err := uuid.Parse(idStr)
+	if err != nil {
+		http.Error(w, "bad id", 400)
+		return
+	}
+	row, err := s.Q.PageByID(r.Context(), pid)
+	if err != nil {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if !canRead(r, row.OwnerID) {
+		http.Error(w, "forbidden", 403)
+		return
+	}
+	s.auditRead(r, pid, row.OwnerID)
+	html, err := s.renderPage(r, pid, row.OwnerID, row.Body, row.UpdatedAt)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(html))
+}
+
+func (s *Service) renderPage(r *http.Request, pid uuid.UUID, ownerID, body string, updatedAt time.Time) (string, error) {
+	ownerUUID, err := uuid.Parse(ownerID)
+	if err != nil {
+		return "", err
+	}
+	pages, err := s.Q.PagesByUser(r.Context(), ownerUUID)
+	if err != nil {
+		return "", err
+	}
+	names := make(map[string]string, len(pages))
+	stamp := strconv.Itoa(len(pages))
+	for i, p := range pages {
+		if i == 0 {
+			stamp += "/" + p.UpdatedAt.UTC().Format(time.RFC3339Nano)
+		}
+		if _, ok := names[p.Name]; !ok {
+			names[p.Name] = p.ID
+		}
+	}
+
+	if html, ok := s.rendered.get(pid, updatedAt, stamp); ok {
+		return html, nil
+	}
+	body = wiki.Expand(pid.String(), body, s.embedFetcher(r, ownerUUID), wiki.WrapEmbed)
+	html, err := wiki.Render(body, func(target string) (string, bool) {
+		id, ok := names[target]
+		return id, ok
+	})
+	if err != nil {
+		return "", err
+	}
+	s.rendered.put(pid, renderEntry{updatedAt: updatedAt, pages: stamp, html: html})
+	return html, nil
+}
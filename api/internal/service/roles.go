@@ -0,0 +1,60 @@
+package service
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/tim/eureka/internal/auth"
+	"github.com/tim/eureka/internal/db"
+)
+
+// AdminRoles lists the built-in roles with their permissions.
+func (s *Service) AdminRoles(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, auth.Roles())
+}
+
+// AdminSetRole assigns a role. The user's sessions are revoked so the new
+// role applies from the next login; access tokens pick it up immediately.
+func (s *Service) AdminSetRole(w http.ResponseWriter, r *http.Request) {
+	uid, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "bad id", 400)
+		return
+	}
+	var req struct {
+		Role string
+	}
+	if !bind(w, r, &req) {
+		return
+	}
+	if !auth.ValidRole(req.Role) {
+		http.Error(w, "unknown role", 400)
+		return
+	}
+	u, err := s.Q.UserByID(r.Context(), uid)
+	if err != nil {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if u.Role == db.UserRoleAdm && req.Role != string(db.UserRoleAdm) {
+		n, err := s.Q.UsersCountByRole(r.Context(), db.UserRoleAdm)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		if n <= 1 {
+			http.Error(w, "cannot demote the last admin", 409)
+			return
+		}
+	}
+	if err := s.Q.UserSetRole(r.Context(), db.UserSetRoleParams{
+		Column1: uid,
+		Role:    db.UserRole(req.Role),
+	}); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	s.audit(r, "user.role", "user", uid.String(), map[string]string{"role": string(u.Role)}, map[string]string{"role": req.Role})
+	writeJSON(w, r, map[string]string{"ok": "1"})
+}
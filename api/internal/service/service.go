@@ -14,40 +14,62 @@ import (
 	"github.com/google/uuid"
 	"github.com/tim/eureka/internal/auth"
 	"github.com/tim/eureka/internal/db"
+	"github.com/tim/eureka/internal/mail"
+	"github.com/tim/eureka/internal/metrics"
+	"github.com/tim/eureka/internal/tracing"
+	"github.com/tim/eureka/internal/validate"
+	"github.com/tim/eureka/internal/wiki"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type Service struct {
 	Q  *db.Queries
 	PG db.DBTX
+
+	Mail   mail.Mailer
+	AppURL string // base URL of the web app, used in mailed links
+
+	Passwords    validate.PasswordPolicy
+	Registration string // RegistrationOpen, RegistrationInvite or RegistrationClosed
+	VerifyEmail  bool   // require a confirmed email before the first login
+
+	Limits LoginLimits
+	SSO    SSO
+
+	MaxImage int64 // largest image upload, in bytes
+
+	rendered renderCache
 }
 
-func hash(pw string) (string, error) {
+func hash(ctx context.Context, pw string) (string, error) {
+	_, span := tracing.Start(ctx, "bcrypt.hash")
+	defer span.End()
 	b, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
 	return string(b), err
 }
-func check(hash, pw string) bool {
+func check(ctx context.Context, hash, pw string) bool {
+	_, span := tracing.Start(ctx, "bcrypt.compare")
+	defer span.End()
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pw)) == nil
 }
 
-func (s *Service) Register(ctx context.Context, email, password string) (string, error) {
-	h, err := hash(password)
-	if err != nil {
-		return "", err
+// inTx runs fn in a transaction when PG is a *sql.DB, and directly on Q
+// otherwise. Queries in the transaction are traced like those on Q.
+func (s *Service) inTx(ctx context.Context, fn func(q *db.Queries) error) error {
+	sqlDB, ok := s.PG.(*sql.DB)
+	if !ok {
+		return fn(s.Q)
 	}
-	id, err := s.Q.UserCreate(ctx, db.UserCreateParams{Email: email, PassHash: h})
-	return id, err
-}
-
-func (s *Service) Login(ctx context.Context, email, password string) (string, string, error) {
-	u, err := s.Q.UserByEmail(ctx, email)
+	tx, err := sqlDB.BeginTx(ctx, nil)
 	if err != nil {
-		return "", "", err
+		return err
 	}
-	if !check(u.PassHash, password) {
-		return "", "", sql.ErrNoRows
+	if err := fn(db.New(tracing.DB(tx))); err != nil {
+		_ = tx.Rollback()
+		return err
 	}
-	return u.ID.String(), string(u.Role), nil
+	return tx.Commit()
 }
 
 func bind(w http.ResponseWriter, r *http.Request, v any) bool {
@@ -57,19 +79,34 @@ func bind(w http.ResponseWriter, r *http.Request, v any) bool {
 	}
 	return true
 }
-func writeJSON(w http.ResponseWriter, v any) { writeJSONCode(w, 200, v) }
-func writeJSONCode(w http.ResponseWriter, code int, v any) {
+func writeJSON(w http.ResponseWriter, r *http.Request, v any) { writeJSONCode(w, r, 200, v) }
+func writeJSONCode(w http.ResponseWriter, r *http.Request, code int, v any) {
+	_, span := tracing.Start(r.Context(), "json.encode")
+	defer span.End()
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 	_ = json.NewEncoder(w).Encode(v)
 }
 
+// canRead reports whether the caller may read a page owned by ownerID.
+func canRead(r *http.Request, ownerID string) bool {
+	uid, _ := r.Context().Value(auth.CtxUserID).(string)
+	return uid == ownerID || auth.Can(r.Context(), auth.PagesReadAny)
+}
+
+// auditRead records a read of a page the caller does not own, which only
+// PagesReadAny allows. Call it once canRead has passed.
+func (s *Service) auditRead(r *http.Request, pid uuid.UUID, ownerID string) {
+	if uid, _ := r.Context().Value(auth.CtxUserID).(string); uid != ownerID {
+		s.audit(r, "page.read", "page", pid.String(), nil, map[string]string{"owner": ownerID})
+	}
+}
+
 func (s *Service) ListPages(w http.ResponseWriter, r *http.Request) {
 	uid := r.Context().Value(auth.CtxUserID).(string)
-	role, _ := r.Context().Value(auth.CtxRole).(string)
 
 	owner := uid
-	if role == "adm" {
+	if auth.Can(r.Context(), auth.PagesReadAny) {
 		if q := r.URL.Query().Get("owner"); q != "" {
 			owner = q
 		} else {
@@ -83,7 +120,8 @@ func (s *Service) ListPages(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), 500)
 			return
 		}
-		writeJSON(w, rows)
+		s.audit(r, "pages.list", "user", "all", nil, map[string]int{"pages": len(rows)})
+		writeJSON(w, r, rows)
 		return
 	}
 
@@ -97,7 +135,10 @@ func (s *Service) ListPages(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), 500)
 		return
 	}
-	writeJSON(w, rows)
+	if owner != uid {
+		s.audit(r, "pages.list", "user", owner, nil, map[string]int{"pages": len(rows)})
+	}
+	writeJSON(w, r, rows)
 }
 
 func (s *Service) CreatePage(w http.ResponseWriter, r *http.Request) {
@@ -123,7 +164,13 @@ func (s *Service) CreatePage(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), 400)
 		return
 	}
-	writeJSONCode(w, 201, map[string]string{"id": id})
+
+	if pid, err := uuid.Parse(id); err == nil {
+		_ = s.syncPageLinks(r.Context(), pid, userID, req.Body)
+		_ = s.syncPageTags(r.Context(), pid, req.Body)
+	}
+
+	writeJSONCode(w, r, 201, map[string]string{"id": id})
 }
 
 func (s *Service) GetPage(w http.ResponseWriter, r *http.Request) {
@@ -138,44 +185,67 @@ func (s *Service) GetPage(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "not found", 404)
 		return
 	}
-	writeJSON(w, row)
+	if !canRead(r, row.OwnerID) {
+		http.Error(w, "forbidden", 403)
+		return
+	}
+	s.auditRead(r, pid, row.OwnerID)
+	if r.URL.Query().Get("expand") == "true" {
+		ownerUUID, err := uuid.Parse(row.OwnerID)
+		if err != nil {
+			http.Error(w, "bad owner uuid", 500)
+			return
+		}
+		row.Body = wiki.Expand(row.ID, row.Body, s.embedFetcher(r, ownerUUID), nil)
+	}
+	writeJSON(w, r, row)
 }
 
-func parseWikiLinks(text string) []string {
-	var links []string
-	start := 0
-	for {
-		idx1 := strings.Index(text[start:], "[[")
-		if idx1 == -1 {
-			break
+// embedFetcher resolves ![[embeds]] against the pages of ownerID, skipping
+// pages the caller may not read.
+func (s *Service) embedFetcher(r *http.Request, ownerID uuid.UUID) wiki.EmbedFetcher {
+	return func(target string) (wiki.Embed, bool) {
+		id, err := s.Q.PageByNameAndUser(r.Context(), db.PageByNameAndUserParams{
+			Column1: ownerID,
+			Name:    target,
+		})
+		if err != nil {
+			return wiki.Embed{}, false
 		}
-		idx1 += start
-		idx2 := strings.Index(text[idx1+2:], "]]")
-		if idx2 == -1 {
-			break
+		pid, err := uuid.Parse(id)
+		if err != nil {
+			return wiki.Embed{}, false
 		}
-		idx2 += idx1 + 2
-		linkText := text[idx1+2 : idx2]
-		linkText = strings.TrimSpace(linkText)
-		if linkText != "" {
-			links = append(links, linkText)
+		row, err := s.Q.PageByID(r.Context(), pid)
+		if err != nil || !canRead(r, row.OwnerID) {
+			return wiki.Embed{}, false
 		}
-		start = idx2 + 2
+		return wiki.Embed{ID: row.ID, Body: row.Body}, true
 	}
-	return links
 }
 
-func (s *Service) syncPageLinks(ctx context.Context, pageID uuid.UUID, userID uuid.UUID, body string) error {
-	wikiLinks := parseWikiLinks(body)
+// embedTag marks parsed links that come from ![[embeds]].
+const embedTag = "embed"
 
-	if err := s.Q.LinksDeleteBySource(ctx, pageID); err != nil {
-		return err
-	}
+type linkKey struct {
+	dest   uuid.UUID
+	anchor string
+	tag    string
+}
 
-	for _, linkName := range wikiLinks {
+// syncPageLinks reconciles the parsed links of a page with the wiki links in
+// its body. Manual links added through AddLink are left untouched.
+func (s *Service) syncPageLinks(ctx context.Context, pageID uuid.UUID, userID uuid.UUID, body string) error {
+	ctx, span := tracing.Start(ctx, "syncPageLinks", attribute.String("page.id", pageID.String()))
+	defer span.End()
+	want := map[linkKey]bool{}
+	for _, l := range wiki.ParseLinks(body) {
+		if l.Target == "" {
+			continue
+		}
 		destID, err := s.Q.PageByNameAndUser(ctx, db.PageByNameAndUserParams{
 			Column1: userID,
-			Name:    linkName,
+			Name:    l.Target,
 		})
 		if err != nil {
 			continue
@@ -185,12 +255,41 @@ func (s *Service) syncPageLinks(ctx context.Context, pageID uuid.UUID, userID uu
 		if err != nil {
 			continue
 		}
+		k := linkKey{dest: destUUID, anchor: l.Anchor}
+		if l.Embed {
+			k.tag = embedTag
+		}
+		want[k] = true
+	}
+
+	have, err := s.Q.LinksParsedBySource(ctx, pageID)
+	if err != nil {
+		return err
+	}
+	for _, l := range have {
+		destUUID, err := uuid.Parse(l.IDDest)
+		if k := (linkKey{destUUID, l.Anchor, l.Tag}); err == nil && want[k] {
+			delete(want, k)
+			continue
+		}
+		linkID, err := uuid.Parse(l.ID)
+		if err != nil {
+			continue
+		}
+		if err := s.Q.LinkDelete(ctx, linkID); err != nil {
+			return err
+		}
+	}
 
-		_, _ = s.Q.LinkCreate(ctx, db.LinkCreateParams{
+	for k := range want {
+		if err := s.Q.LinkCreateParsed(ctx, db.LinkCreateParsedParams{
 			Column1: pageID,
-			Column2: destUUID,
-			Column3: nil,
-		})
+			Column2: k.dest,
+			Column3: k.anchor,
+			Column4: k.tag,
+		}); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -211,16 +310,22 @@ func (s *Service) UpdatePage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	uid := r.Context().Value(auth.CtxUserID).(string)
-	role, _ := r.Context().Value(auth.CtxRole).(string)
 	owner, err := s.Q.PageOwner(r.Context(), pid)
 	if err != nil {
 		http.Error(w, "not found", 404)
 		return
 	}
-	if role != "adm" && owner != uid {
+	if owner != uid && !auth.Can(r.Context(), auth.PagesWriteAny) {
 		http.Error(w, "forbidden", 403)
 		return
 	}
+	var before db.PageByIDRow
+	if owner != uid {
+		if before, err = s.Q.PageByID(r.Context(), pid); err != nil {
+			http.Error(w, "not found", 404)
+			return
+		}
+	}
 	if err := s.Q.PageUpdate(r.Context(), db.PageUpdateParams{
 		Column1: pid,
 		Name:    req.Name,
@@ -229,11 +334,16 @@ func (s *Service) UpdatePage(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), 400)
 		return
 	}
+	if owner != uid {
+		s.audit(r, "page.update", "page", pid.String(), pageAudit(before),
+			map[string]string{"owner": owner, "name": req.Name, "body": req.Body})
+	}
 
 	userUUID, _ := uuid.Parse(uid)
 	_ = s.syncPageLinks(r.Context(), pid, userUUID, req.Body)
+	_ = s.syncPageTags(r.Context(), pid, req.Body)
 
-	writeJSON(w, map[string]string{"ok": "1"})
+	writeJSON(w, r, map[string]string{"ok": "1"})
 }
 
 func (s *Service) DeletePage(w http.ResponseWriter, r *http.Request) {
@@ -244,21 +354,30 @@ func (s *Service) DeletePage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	uid := r.Context().Value(auth.CtxUserID).(string)
-	role, _ := r.Context().Value(auth.CtxRole).(string)
 	owner, err := s.Q.PageOwner(r.Context(), pid)
 	if err != nil {
 		http.Error(w, "not found", 404)
 		return
 	}
-	if role != "adm" && owner != uid {
+	if owner != uid && !auth.Can(r.Context(), auth.PagesDeleteAny) {
 		http.Error(w, "forbidden", 403)
 		return
 	}
-	if err := s.Q.PageDelete(r.Context(), pid); err != nil {
+	var before db.PageByIDRow
+	if owner != uid {
+		if before, err = s.Q.PageByID(r.Context(), pid); err != nil {
+			http.Error(w, "not found", 404)
+			return
+		}
+	}
+	if err := s.trashPage(r.Context(), pid); err != nil {
 		http.Error(w, err.Error(), 400)
 		return
 	}
-	writeJSON(w, map[string]string{"ok": "1"})
+	if owner != uid {
+		s.audit(r, "page.delete", "page", pid.String(), pageAudit(before), map[string]bool{"trashed": true})
+	}
+	writeJSON(w, r, map[string]string{"ok": "1"})
 }
 
 func (s *Service) ChangeOwner(w http.ResponseWriter, r *http.Request) {
@@ -279,6 +398,11 @@ func (s *Service) ChangeOwner(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad user_id", 400)
 		return
 	}
+	owner, err := s.Q.PageOwner(r.Context(), pid)
+	if err != nil {
+		http.Error(w, "not found", 404)
+		return
+	}
 	if err := s.Q.PageSetOwner(r.Context(), db.PageSetOwnerParams{
 		Column1: pid,
 		Column2: newOwner,
@@ -286,7 +410,9 @@ func (s *Service) ChangeOwner(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), 400)
 		return
 	}
-	writeJSON(w, map[string]string{"ok": "1"})
+	s.audit(r, "page.transfer", "page", pid.String(),
+		map[string]string{"owner": owner}, map[string]string{"owner": newOwner.String()})
+	writeJSON(w, r, map[string]string{"ok": "1"})
 }
 
 func (s *Service) ListLinks(w http.ResponseWriter, r *http.Request) {
@@ -301,7 +427,7 @@ func (s *Service) ListLinks(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), 400)
 		return
 	}
-	writeJSON(w, rows)
+	writeJSON(w, r, rows)
 }
 
 func (s *Service) AddLink(w http.ResponseWriter, r *http.Request) {
@@ -314,6 +440,7 @@ func (s *Service) AddLink(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		IDDest string
 		Tag    string
+		Anchor string
 	}
 	if !bind(w, r, &req) {
 		return
@@ -331,12 +458,13 @@ func (s *Service) AddLink(w http.ResponseWriter, r *http.Request) {
 		Column1: src,
 		Column2: dest,
 		Column3: tag,
+		Column4: strings.TrimSpace(req.Anchor),
 	})
 	if err != nil {
 		http.Error(w, err.Error(), 400)
 		return
 	}
-	writeJSONCode(w, 201, map[string]string{"id": id})
+	writeJSONCode(w, r, 201, map[string]string{"id": id})
 }
 
 func (s *Service) DelLink(w http.ResponseWriter, r *http.Request) {
@@ -350,11 +478,9 @@ func (s *Service) DelLink(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), 400)
 		return
 	}
-	writeJSON(w, map[string]string{"ok": "1"})
+	writeJSON(w, r, map[string]string{"ok": "1"})
 }
 
-const maxImage = 5 << 20
-
 var allowed = map[string]bool{
 	"image/png":  true,
 	"image/jpeg": true,
@@ -369,7 +495,7 @@ func (s *Service) UploadImage(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad id", 400)
 		return
 	}
-	if err := r.ParseMultipartForm(maxImage + 1024); err != nil {
+	if err := r.ParseMultipartForm(s.MaxImage + 1024); err != nil {
 		http.Error(w, "multipart", 400)
 		return
 	}
@@ -381,15 +507,17 @@ func (s *Service) UploadImage(w http.ResponseWriter, r *http.Request) {
 	defer f.Close()
 	mime := hdr.Header.Get("Content-Type")
 	if !allowed[strings.ToLower(mime)] {
+		metrics.ImageUploads.WithLabelValues("bad_type").Inc()
 		http.Error(w, "mime", 400)
 		return
 	}
 	var buf bytes.Buffer
-	if _, err := io.CopyN(&buf, f, maxImage+1); err != nil && err != io.EOF {
+	if _, err := io.CopyN(&buf, f, s.MaxImage+1); err != nil && err != io.EOF {
 		http.Error(w, "read", 400)
 		return
 	}
-	if buf.Len() > maxImage {
+	if int64(buf.Len()) > s.MaxImage {
+		metrics.ImageUploads.WithLabelValues("too_large").Inc()
 		http.Error(w, "too large", 413)
 		return
 	}
@@ -404,7 +532,9 @@ func (s *Service) UploadImage(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), 400)
 		return
 	}
-	writeJSONCode(w, 201, map[string]string{"id": id})
+	metrics.ImageUploads.WithLabelValues("ok").Inc()
+	metrics.ImageUploadBytes.Add(float64(buf.Len()))
+	writeJSONCode(w, r, 201, map[string]string{"id": id})
 }
 
 func (s *Service) GetImage(w http.ResponseWriter, r *http.Request) {
@@ -436,7 +566,7 @@ func (s *Service) ListImages(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), 400)
 		return
 	}
-	writeJSON(w, images)
+	writeJSON(w, r, images)
 }
 
 func (s *Service) UserGraph(w http.ResponseWriter, r *http.Request) {
@@ -451,7 +581,15 @@ func (s *Service) UserGraph(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), 500)
 		return
 	}
-	writeJSON(w, rows)
+	if r.URL.Query().Get("tags") == "true" {
+		tagRows, err := s.graphTagRows(r.Context(), uid)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		rows = append(rows, tagRows...)
+	}
+	writeJSON(w, r, rows)
 }
 
 func (s *Service) AdminPages(w http.ResponseWriter, r *http.Request) {
@@ -460,7 +598,8 @@ func (s *Service) AdminPages(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), 500)
 		return
 	}
-	writeJSON(w, rows)
+	s.audit(r, "pages.list", "user", "all", nil, map[string]int{"pages": len(rows)})
+	writeJSON(w, r, rows)
 }
 
 func (s *Service) AdminUsers(w http.ResponseWriter, r *http.Request) {
@@ -469,33 +608,30 @@ func (s *Service) AdminUsers(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), 500)
 		return
 	}
-	writeJSON(w, rows)
+	writeJSON(w, r, rows)
 }
 
-func (s *Service) AdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+func (s *Service) AdminDeletePage(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
-	uid, err := uuid.Parse(idStr)
+	pid, err := uuid.Parse(idStr)
 	if err != nil {
 		http.Error(w, "bad id", 400)
 		return
 	}
-	if err := s.Q.UserDelete(r.Context(), uid); err != nil {
-		http.Error(w, err.Error(), 400)
-		return
-	}
-	writeJSON(w, map[string]string{"ok": "1"})
-}
-
-func (s *Service) AdminDeletePage(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	pid, err := uuid.Parse(idStr)
+	before, err := s.Q.PageByID(r.Context(), pid)
 	if err != nil {
-		http.Error(w, "bad id", 400)
+		http.Error(w, "not found", 404)
 		return
 	}
-	if err := s.Q.PageDelete(r.Context(), pid); err != nil {
+	if err := s.trashPage(r.Context(), pid); err != nil {
 		http.Error(w, err.Error(), 400)
 		return
 	}
-	writeJSON(w, map[string]string{"ok": "1"})
+	s.audit(r, "page.delete", "page", pid.String(), pageAudit(before), map[string]bool{"trashed": true})
+	writeJSON(w, r, map[string]string{"ok": "1"})
+}
+
+// pageAudit is what the audit log keeps of a page before a change.
+func pageAudit(p db.PageByIDRow) map[string]string {
+	return map[string]string{"owner": p.OwnerID, "name": p.Name, "body": p.Body}
 }
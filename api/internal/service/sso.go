@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tim/eureka/internal/db"
+	apperr "github.com/tim/eureka/internal/errors"
+	"github.com/tim/eureka/internal/oidc"
+	"github.com/tim/eureka/internal/validate"
+)
+
+// SSO configures OpenID Connect login. Provider is nil when SSO is off.
+type SSO struct {
+	Provider  *oidc.Provider
+	Provision bool     // create accounts for unknown verified emails
+	Domains   []string // if set, only emails in these domains may sign in
+}
+
+var (
+	ErrSSOEmailUnverified = apperr.New("sso_email_unverified", "the identity provider did not verify the email", http.StatusForbidden)
+	ErrSSODomain          = apperr.New("sso_domain", "email domain not allowed", http.StatusForbidden)
+	ErrSSONoAccount       = apperr.New("sso_no_account", "no account for this email", http.StatusForbidden)
+)
+
+// noPassword is stored for accounts created by SSO. It is not a bcrypt
+// hash, so password login fails until the user sets one through the reset
+// flow.
+const noPassword = "!"
+
+// SSOLogin maps a verified identity to a user, creating it when allowed.
+// Like Login, it returns ErrTwoFactorRequired with the user ID and role
+// when the account has TOTP enabled.
+func (s *Service) SSOLogin(ctx context.Context, id oidc.Identity) (string, string, error) {
+	if !id.EmailVerified {
+		return "", "", ErrSSOEmailUnverified
+	}
+	email, err := validate.Email(id.Email)
+	if err != nil {
+		return "", "", ErrSSOEmailUnverified.WithMessage(err.Error())
+	}
+	if len(s.SSO.Domains) > 0 {
+		_, domain, _ := strings.Cut(email, "@")
+		if !slices.Contains(s.SSO.Domains, domain) {
+			return "", "", ErrSSODomain
+		}
+	}
+
+	u, err := s.Q.UserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		if !s.SSO.Provision {
+			return "", "", ErrSSONoAccount
+		}
+		uid, err := s.Q.UserCreate(ctx, db.UserCreateParams{
+			Email:           email,
+			PassHash:        noPassword,
+			EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		if err != nil {
+			return "", "", err
+		}
+		return uid, string(db.UserRoleUser), nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if u.DisabledAt.Valid {
+		return "", "", ErrAccountDisabled
+	}
+	if !u.EmailVerifiedAt.Valid {
+		if err := s.Q.UserSetEmailVerified(ctx, u.ID); err != nil {
+			return "", "", err
+		}
+	}
+	if u.TotpEnabledAt.Valid {
+		return u.ID.String(), string(u.Role), ErrTwoFactorRequired
+	}
+	if err := s.Q.UserLoginSucceeded(ctx, u.ID); err != nil {
+		return "", "", err
+	}
+	return u.ID.String(), string(u.Role), nil
+}
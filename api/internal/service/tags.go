@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/tim/eureka/internal/auth"
+	"github.com/tim/eureka/internal/db"
+	"github.com/tim/eureka/internal/wiki"
+)
+
+// syncPageTags reconciles page_tags with the hashtags in a page body.
+func (s *Service) syncPageTags(ctx context.Context, pageID uuid.UUID, body string) error {
+	want := map[string]bool{}
+	for _, t := range wiki.ParseTags(body) {
+		want[t.Name] = true
+	}
+	have, err := s.Q.TagsByPage(ctx, pageID)
+	if err != nil {
+		return err
+	}
+	for _, tag := range have {
+		if want[tag] {
+			delete(want, tag)
+			continue
+		}
+		if err := s.Q.TagDelete(ctx, db.TagDeleteParams{Column1: pageID, Tag: tag}); err != nil {
+			return err
+		}
+	}
+	for tag := range want {
+		if err := s.Q.TagAdd(ctx, db.TagAddParams{Column1: pageID, Tag: tag}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settingTagsIndexed marks a database whose pages have all been through
+// ReindexTags, so BackfillTags runs once per database.
+const settingTagsIndexed = "tags_indexed"
+
+// ReindexTags rebuilds page_tags from the bodies of all pages and returns
+// the number of pages synced.
+func (s *Service) ReindexTags(ctx context.Context) (int, error) {
+	pages, err := s.Q.TagIndexPages(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range pages {
+		if err := s.syncPageTags(ctx, p.ID, p.Body); err != nil {
+			return 0, err
+		}
+	}
+	return len(pages), s.Q.SettingSet(ctx, db.SettingSetParams{Key: settingTagsIndexed, Value: "true"})
+}
+
+// BackfillTags indexes the pages written before hashtags were indexed. It
+// runs ReindexTags the first time only and returns 0 after that.
+func (s *Service) BackfillTags(ctx context.Context) (int, error) {
+	v, err := s.Q.SettingGet(ctx, settingTagsIndexed)
+	switch {
+	case err == nil && v == "true":
+		return 0, nil
+	case err != nil && !errors.Is(err, sql.ErrNoRows):
+		return 0, err
+	}
+	return s.ReindexTags(ctx)
+}
+
+func (s *Service) ListTags(w http.ResponseWriter, r *http.Request) {
+	uidStr := r.Context().Value(auth.CtxUserID).(string)
+	uid, err := uuid.Parse(uidStr)
+	if err != nil {
+		http.Error(w, "bad uid", 400)
+		return
+	}
+	rows, err := s.Q.TagsByUser(r.Context(), uid)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writeJSON(w, r, rows)
+}
+
+// TagPages lists the caller's pages tagged with ?tag= or any tag nested
+// under it.
+func (s *Service) TagPages(w http.ResponseWriter, r *http.Request) {
+	uidStr := r.Context().Value(auth.CtxUserID).(string)
+	uid, err := uuid.Parse(uidStr)
+	if err != nil {
+		http.Error(w, "bad uid", 400)
+		return
+	}
+	tag := strings.ToLower(strings.TrimPrefix(r.URL.Query().Get("tag"), "#"))
+	if !wiki.ValidTag(tag) {
+		http.Error(w, "bad tag", 400)
+		return
+	}
+	rows, err := s.Q.PagesByTag(r.Context(), db.PagesByTagParams{Column1: uid, Column2: tag})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writeJSON(w, r, rows)
+}
+
+// RenameTag renames a tag and its nested children in all of the caller's
+// pages, rewriting their bodies.
+func (s *Service) RenameTag(w http.ResponseWriter, r *http.Request) {
+	uidStr := r.Context().Value(auth.CtxUserID).(string)
+	uid, err := uuid.Parse(uidStr)
+	if err != nil {
+		http.Error(w, "bad uid", 400)
+		return
+	}
+	var req struct {
+		From string
+		To   string
+	}
+	if !bind(w, r, &req) {
+		return
+	}
+	from := strings.ToLower(strings.TrimPrefix(req.From, "#"))
+	to := strings.ToLower(strings.TrimPrefix(req.To, "#"))
+	if !wiki.ValidTag(from) || !wiki.ValidTag(to) {
+		http.Error(w, "bad tag", 400)
+		return
+	}
+	pages, err := s.Q.PagesByTag(r.Context(), db.PagesByTagParams{Column1: uid, Column2: from})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	n := 0
+	for _, p := range pages {
+		body, changed := wiki.RenameTag(p.Body, from, to)
+		if !changed {
+			continue
+		}
+		pid, err := uuid.Parse(p.ID)
+		if err != nil {
+			continue
+		}
+		if err := s.Q.PageUpdate(r.Context(), db.PageUpdateParams{
+			Column1: pid,
+			Name:    p.Name,
+			Body:    body,
+		}); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		if err := s.syncPageTags(r.Context(), pid, body); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		n++
+	}
+	writeJSON(w, r, map[string]int{"pages": n})
+}
+
+// graphTagRows returns /api/graph rows that add tags as nodes, with an
+// edge from every tagged page.
+func (s *Service) graphTagRows(ctx context.Context, uid uuid.UUID) ([]db.GraphByUserRow, error) {
+	tags, err := s.Q.GraphTagsByUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]db.GraphByUserRow, 0, len(tags))
+	for _, t := range tags {
+		node := "tag:" + t.Tag
+		rows = append(rows, db.GraphByUserRow{
+			NodeID:   node,
+			NodeName: "#" + t.Tag,
+			EdgeFrom: t.PageID,
+			EdgeTo:   node,
+			Tag:      sql.NullString{String: "tag", Valid: true},
+		})
+	}
+	return rows, nil
+}
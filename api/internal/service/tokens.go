@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/tim/eureka/internal/auth"
+	"github.com/tim/eureka/internal/db"
+	"github.com/tim/eureka/internal/middleware"
+)
+
+const maxTokenName = 100
+
+// LookupAccessToken implements auth.TokenLookupFunc.
+func (s *Service) LookupAccessToken(ctx context.Context, tok string) (string, string, string, error) {
+	t, err := s.Q.AccessTokenLookup(ctx, hashSecret(tok))
+	if err != nil {
+		return "", "", "", err
+	}
+	if err := s.Q.AccessTokenTouch(ctx, t.ID); err != nil {
+		middleware.Log(ctx).Warn("access token touch", "err", err)
+	}
+	return t.UserID, string(t.Role), string(t.Scope), nil
+}
+
+func (s *Service) ListTokens(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	rows, err := s.Q.AccessTokensByUser(r.Context(), u.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writeJSON(w, r, rows)
+}
+
+// CreateToken issues a personal access token. The token itself is returned
+// only here; the database keeps its hash.
+func (s *Service) CreateToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name          string
+		Scope         string
+		ExpiresInDays int
+	}
+	if !bind(w, r, &req) {
+		return
+	}
+	u, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxTokenName {
+		http.Error(w, "name must be 1-100 characters", 400)
+		return
+	}
+	scope := db.TokenScope(req.Scope)
+	if req.Scope == "" {
+		scope = db.TokenScopeRead
+	}
+	if scope != db.TokenScopeRead && scope != db.TokenScopeWrite {
+		http.Error(w, "scope must be read or write", 400)
+		return
+	}
+	if req.ExpiresInDays < 0 {
+		http.Error(w, "bad expiry", 400)
+		return
+	}
+	var exp sql.NullTime
+	if req.ExpiresInDays > 0 {
+		exp = sql.NullTime{Time: time.Now().AddDate(0, 0, req.ExpiresInDays), Valid: true}
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	tok := auth.TokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	id, err := s.Q.AccessTokenCreate(r.Context(), db.AccessTokenCreateParams{
+		Column1:   u.ID,
+		Name:      name,
+		TokenHash: hashSecret(tok),
+		Scope:     scope,
+		ExpiresAt: exp,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writeJSONCode(w, r, 201, map[string]any{
+		"id":         id,
+		"name":       name,
+		"scope":      scope,
+		"expires_at": exp,
+		"token":      tok,
+	})
+}
+
+func (s *Service) DeleteToken(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "bad id", 400)
+		return
+	}
+	n, err := s.Q.AccessTokenDelete(r.Context(), db.AccessTokenDeleteParams{Column1: id, Column2: u.ID})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if n == 0 {
+		http.Error(w, "not found", 404)
+		return
+	}
+	writeJSON(w, r, map[string]string{"ok": "1"})
+}
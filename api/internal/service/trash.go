@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/tim/eureka/internal/auth"
+	"github.com/tim/eureka/internal/db"
+	"github.com/tim/eureka/internal/middleware"
+)
+
+// trashPage moves a page to its owner's trash. Its links are kept, so a
+// restore brings back manual links too; the link and graph queries skip
+// links with a trashed page at either end.
+func (s *Service) trashPage(ctx context.Context, pid uuid.UUID) error {
+	n, err := s.Q.PageTrash(ctx, pid)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *Service) ListTrash(w http.ResponseWriter, r *http.Request) {
+	uid, err := uuid.Parse(r.Context().Value(auth.CtxUserID).(string))
+	if err != nil {
+		http.Error(w, "bad uid", 400)
+		return
+	}
+	rows, err := s.Q.PagesTrashByUser(r.Context(), uid)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writeJSON(w, r, rows)
+}
+
+// trashedPage loads a page in the trash that the caller may restore or
+// purge: their own, or any with pages.delete.any.
+func (s *Service) trashedPage(w http.ResponseWriter, r *http.Request) (uuid.UUID, db.PageTrashedByIDRow, bool) {
+	pid, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "bad id", 400)
+		return pid, db.PageTrashedByIDRow{}, false
+	}
+	p, err := s.Q.PageTrashedByID(r.Context(), pid)
+	if err != nil {
+		http.Error(w, "not found", 404)
+		return pid, p, false
+	}
+	uid := r.Context().Value(auth.CtxUserID).(string)
+	if p.UserID.String() != uid && !auth.Can(r.Context(), auth.PagesDeleteAny) {
+		http.Error(w, "not found", 404)
+		return pid, p, false
+	}
+	return pid, p, true
+}
+
+// RestorePage takes a page out of the trash. Its link rows were kept; the
+// parsed links are synced again, from its own body and from the owner's
+// pages that link to it by name, since those pages may have been edited
+// while it was in the trash.
+func (s *Service) RestorePage(w http.ResponseWriter, r *http.Request) {
+	pid, p, ok := s.trashedPage(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	if _, err := s.Q.PageByNameAndUser(ctx, db.PageByNameAndUserParams{Column1: p.UserID, Name: p.Name}); err == nil {
+		http.Error(w, "a page with this name exists", 409)
+		return
+	}
+	if err := s.Q.PageRestore(ctx, pid); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	_ = s.syncPageLinks(ctx, pid, p.UserID, p.Body)
+	others, err := s.Q.PagesMentioning(ctx, db.PagesMentioningParams{
+		Column1: p.UserID,
+		Column2: pid,
+		Column3: p.Name,
+	})
+	if err != nil {
+		middleware.Log(ctx).Error("restore: pages mentioning", "page_id", pid, "err", err)
+	}
+	for _, o := range others {
+		_ = s.syncPageLinks(ctx, o.ID, p.UserID, o.Body)
+	}
+	writeJSON(w, r, map[string]string{"ok": "1"})
+}
+
+// PurgePage deletes a page in the trash for good, with its images.
+func (s *Service) PurgePage(w http.ResponseWriter, r *http.Request) {
+	pid, p, ok := s.trashedPage(w, r)
+	if !ok {
+		return
+	}
+	if err := s.Q.PageDelete(r.Context(), pid); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if uid := r.Context().Value(auth.CtxUserID).(string); p.UserID.String() != uid {
+		s.audit(r, "page.purge", "page", pid.String(),
+			map[string]string{"owner": p.UserID.String(), "name": p.Name, "body": p.Body}, nil)
+	}
+	writeJSON(w, r, map[string]string{"ok": "1"})
+}
+
+func (s *Service) EmptyTrash(w http.ResponseWriter, r *http.Request) {
+	uid, err := uuid.Parse(r.Context().Value(auth.CtxUserID).(string))
+	if err != nil {
+		http.Error(w, "bad uid", 400)
+		return
+	}
+	n, err := s.Q.PagesPurgeTrashByUser(r.Context(), uid)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writeJSON(w, r, map[string]int64{"purged": n})
+}
+
+// PurgeTrash deletes pages that have been in the trash for longer than
+// retention.
+func (s *Service) PurgeTrash(ctx context.Context, retention time.Duration) (int64, error) {
+	return s.Q.PagesPurgeTrashed(ctx, time.Now().Add(-retention))
+}
+
+// PurgeTrashEvery runs PurgeTrash at the given interval until ctx is done.
+func (s *Service) PurgeTrashEvery(ctx context.Context, every, retention time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		n, err := s.PurgeTrash(ctx, retention)
+		if err != nil {
+			slog.Error("trash purge", "err", err)
+		} else if n > 0 {
+			slog.Info("trash purge", "pages", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
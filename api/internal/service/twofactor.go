@@ -0,0 +1,340 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tim/eureka/internal/auth"
+	"github.com/tim/eureka/internal/db"
+	"github.com/tim/eureka/internal/metrics"
+	"github.com/tim/eureka/internal/totp"
+)
+
+const (
+	totpIssuer        = "Eureka"
+	totpSkew          = 1 // accepted clock drift, in 30 second steps
+	recoveryCodeCount = 10
+
+	settingAdmin2FA = "require_admin_2fa"
+)
+
+// ErrTwoFactorRequired is returned by Login, together with the user ID and
+// role, when the password was right but the account has TOTP enabled.
+var ErrTwoFactorRequired = errors.New("two-factor authentication required")
+
+// CompleteTwoFactor finishes a login started by Login with a TOTP code or a
+// recovery code. Failures count against the same limits as passwords.
+func (s *Service) CompleteTwoFactor(ctx context.Context, ip, uidStr, code string) (string, error) {
+	uid, err := uuid.Parse(uidStr)
+	if err != nil {
+		return "", ErrBadCredentials
+	}
+	u, err := s.Q.UserByID(ctx, uid)
+	if err != nil || !u.TotpEnabledAt.Valid {
+		return "", ErrBadCredentials
+	}
+	if u.DisabledAt.Valid {
+		return "", ErrAccountDisabled
+	}
+	email := strings.ToLower(u.Email)
+	if d := max(wait(s.Limits.PerIP, ip), wait(s.Limits.PerAccount, email)); d > 0 {
+		metrics.LoginFailures.WithLabelValues("throttled").Inc()
+		return "", &ThrottledError{RetryAfter: d}
+	}
+	if u.LockedUntil.Valid && time.Now().Before(u.LockedUntil.Time) {
+		metrics.LoginFailures.WithLabelValues("throttled").Inc()
+		return "", &ThrottledError{RetryAfter: time.Until(u.LockedUntil.Time)}
+	}
+	if !s.checkSecondFactor(ctx, u, code) {
+		s.loginFailed(ctx, ip, email, u.ID, "second_factor")
+		return "", ErrBadCredentials
+	}
+	s.loginSucceeded(ctx, email, u.ID)
+	return string(u.Role), nil
+}
+
+// checkSecondFactor accepts a current TOTP code that has not been used yet,
+// or an unused recovery code, which is then spent.
+func (s *Service) checkSecondFactor(ctx context.Context, u db.User, code string) bool {
+	if !u.TotpSecret.Valid {
+		return false
+	}
+	if step, ok := totp.Verify(u.TotpSecret.String, code, time.Now(), totpSkew); ok {
+		n, err := s.Q.UserTotpUseStep(ctx, db.UserTotpUseStepParams{Column1: u.ID, TotpLastStep: step})
+		return err == nil && n == 1
+	}
+	n, err := s.Q.RecoveryCodeUse(ctx, db.RecoveryCodeUseParams{
+		Column1:  u.ID,
+		CodeHash: hashSecret(normalizeRecoveryCode(code)),
+	})
+	return err == nil && n == 1
+}
+
+func normalizeRecoveryCode(c string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(c)))
+}
+
+// newRecoveryCodes replaces the user's recovery codes and returns the new
+// ones. Only their hashes are stored.
+func (s *Service) newRecoveryCodes(ctx context.Context, uid uuid.UUID) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	err := s.inTx(ctx, func(q *db.Queries) error {
+		if err := q.RecoveryCodesDeleteByUser(ctx, uid); err != nil {
+			return err
+		}
+		for i := range codes {
+			b := make([]byte, 7)
+			if _, err := rand.Read(b); err != nil {
+				return err
+			}
+			c := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+			codes[i] = c[:5] + "-" + c[5:]
+			if err := q.RecoveryCodeCreate(ctx, db.RecoveryCodeCreateParams{
+				Column1:  uid,
+				CodeHash: hashSecret(c),
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return codes, err
+}
+
+func (s *Service) adminTwoFactorRequired(ctx context.Context) bool {
+	v, err := s.Q.SettingGet(ctx, settingAdmin2FA)
+	return err == nil && v == "true"
+}
+
+// TwoFactorPolicy marks requests that fall short of the 2FA policy: when
+// the instance requires 2FA for privileged roles (see auth.Privileged),
+// their sessions must have passed a second factor, which personal access
+// tokens never have. auth.Can then refuses every privileged permission for
+// the request, so a user without 2FA can still use their own pages and the
+// account routes to enroll.
+func (s *Service) TwoFactorPolicy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role, _ := r.Context().Value(auth.CtxRole).(string)
+		if auth.Privileged(role) && s.adminTwoFactorRequired(r.Context()) && !s.twoFactorMet(r) {
+			r = r.WithContext(context.WithValue(r.Context(), auth.CtxTwoFactorPending, true))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// twoFactorMet reports whether the request comes from a session that passed
+// a second factor, for an account that still has 2FA enabled.
+func (s *Service) twoFactorMet(r *http.Request) bool {
+	if !auth.TwoFactorDone(r.Context()) {
+		return false
+	}
+	uid, err := uuid.Parse(r.Context().Value(auth.CtxUserID).(string))
+	if err != nil {
+		return false
+	}
+	u, err := s.Q.UserByID(r.Context(), uid)
+	return err == nil && u.TotpEnabledAt.Valid
+}
+
+func (s *Service) TwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	left, err := s.Q.RecoveryCodesLeft(r.Context(), u.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writeJSON(w, r, map[string]any{
+		"enabled":           u.TotpEnabledAt.Valid,
+		"required":          auth.Privileged(string(u.Role)) && s.adminTwoFactorRequired(r.Context()),
+		"recoveryCodesLeft": left,
+	})
+}
+
+// TwoFactorEnroll creates a new pending TOTP secret. It only takes effect
+// after TwoFactorConfirm.
+func (s *Service) TwoFactorEnroll(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string
+	}
+	if !bind(w, r, &req) {
+		return
+	}
+	u, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if !check(r.Context(), u.PassHash, req.Password) {
+		http.Error(w, "wrong password", 403)
+		return
+	}
+	if u.TotpEnabledAt.Valid {
+		http.Error(w, "two-factor authentication already enabled", 409)
+		return
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if err := s.Q.UserTotpSetSecret(r.Context(), db.UserTotpSetSecretParams{
+		Column1:    u.ID,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	}); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writeJSON(w, r, map[string]string{
+		"secret": secret,
+		"uri":    totp.URI(totpIssuer, u.Email, secret),
+	})
+}
+
+// TwoFactorConfirm enables TOTP once the user proves the app is set up, and
+// returns the recovery codes. They are shown only this once. Existing
+// sessions are revoked, so the next login goes through the second factor.
+func (s *Service) TwoFactorConfirm(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string
+	}
+	if !bind(w, r, &req) {
+		return
+	}
+	u, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if u.TotpEnabledAt.Valid {
+		http.Error(w, "two-factor authentication already enabled", 409)
+		return
+	}
+	if !u.TotpSecret.Valid {
+		http.Error(w, "enroll first", 400)
+		return
+	}
+	step, ok := totp.Verify(u.TotpSecret.String, req.Code, time.Now(), totpSkew)
+	if !ok {
+		http.Error(w, "wrong code", 400)
+		return
+	}
+	if err := s.Q.UserTotpEnable(r.Context(), db.UserTotpEnableParams{Column1: u.ID, TotpLastStep: step}); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	codes, err := s.newRecoveryCodes(r.Context(), u.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writeJSON(w, r, map[string]any{"recoveryCodes": codes})
+}
+
+// TwoFactorRecoveryCodes replaces the recovery codes. It takes a current
+// TOTP code or one of the old recovery codes.
+func (s *Service) TwoFactorRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string
+	}
+	if !bind(w, r, &req) {
+		return
+	}
+	u, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if !u.TotpEnabledAt.Valid || !s.checkSecondFactor(r.Context(), u, req.Code) {
+		http.Error(w, "wrong code", 403)
+		return
+	}
+	codes, err := s.newRecoveryCodes(r.Context(), u.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writeJSON(w, r, map[string]any{"recoveryCodes": codes})
+}
+
+func (s *Service) TwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string
+		Code     string
+	}
+	if !bind(w, r, &req) {
+		return
+	}
+	u, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if !check(r.Context(), u.PassHash, req.Password) {
+		http.Error(w, "wrong password", 403)
+		return
+	}
+	if u.TotpEnabledAt.Valid {
+		if auth.Privileged(string(u.Role)) && s.adminTwoFactorRequired(r.Context()) {
+			http.Error(w, "two-factor authentication is required for your role", 403)
+			return
+		}
+		if !s.checkSecondFactor(r.Context(), u, req.Code) {
+			http.Error(w, "wrong code", 403)
+			return
+		}
+	}
+	err := s.inTx(r.Context(), func(q *db.Queries) error {
+		if err := q.UserTotpDisable(r.Context(), u.ID); err != nil {
+			return err
+		}
+		return q.RecoveryCodesDeleteByUser(r.Context(), u.ID)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	writeJSON(w, r, map[string]string{"ok": "1"})
+}
+
+func (s *Service) AdminTwoFactorPolicy(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, map[string]bool{"requiredForAdmins": s.adminTwoFactorRequired(r.Context())})
+}
+
+// AdminSetTwoFactorPolicy turns the 2FA requirement for privileged roles on
+// or off. The setting keeps its historical "admins" name.
+// The caller must have 2FA enabled to turn it on, so it cannot lock itself
+// out of the admin routes.
+func (s *Service) AdminSetTwoFactorPolicy(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RequiredForAdmins bool
+	}
+	if !bind(w, r, &req) {
+		return
+	}
+	u, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if req.RequiredForAdmins && !u.TotpEnabledAt.Valid {
+		http.Error(w, "enable two-factor authentication for your own account first", 409)
+		return
+	}
+	was := s.adminTwoFactorRequired(r.Context())
+	v := "false"
+	if req.RequiredForAdmins {
+		v = "true"
+	}
+	if err := s.Q.SettingSet(r.Context(), db.SettingSetParams{Key: settingAdmin2FA, Value: v}); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	s.audit(r, "settings.2fa", "setting", settingAdmin2FA,
+		map[string]bool{"requiredForAdmins": was}, map[string]bool{"requiredForAdmins": req.RequiredForAdmins})
+	writeJSON(w, r, map[string]bool{"requiredForAdmins": req.RequiredForAdmins})
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/tim/eureka/internal/auth"
+	"github.com/tim/eureka/internal/db"
+	"github.com/tim/eureka/internal/validate"
+)
+
+// AdminCreateUser creates an account with a verified email. Without a
+// password, the user is mailed a reset link to set one.
+func (s *Service) AdminCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email    string
+		Password string
+		Role     string
+	}
+	if !bind(w, r, &req) {
+		return
+	}
+	email, err := validate.Email(req.Email)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	role := req.Role
+	if role == "" {
+		role = string(db.UserRoleUser)
+	}
+	if !auth.ValidRole(role) {
+		http.Error(w, "unknown role", 400)
+		return
+	}
+	h := noPassword
+	if req.Password != "" {
+		if err := s.Passwords.Check(req.Password, email); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		if h, err = hash(r.Context(), req.Password); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+	id, err := s.Q.AdminUserCreate(r.Context(), db.AdminUserCreateParams{
+		Email:    email,
+		PassHash: h,
+		Role:     db.UserRole(role),
+	})
+	if isUniqueViolation(err) {
+		http.Error(w, "email taken", 409)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if req.Password == "" {
+		s.sendReset(r.Context(), uuid.MustParse(id), email)
+	}
+	s.audit(r, "user.create", "user", id, nil, map[string]string{"email": email, "role": role})
+	writeJSONCode(w, r, 201, map[string]string{"id": id})
+}
+
+// targetUser loads the user named in the URL for an admin action. Admins
+// cannot apply these actions to themselves.
+func (s *Service) targetUser(w http.ResponseWriter, r *http.Request) (db.User, bool) {
+	uid, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "bad id", 400)
+		return db.User{}, false
+	}
+	if self, _ := r.Context().Value(auth.CtxUserID).(string); self == uid.String() {
+		http.Error(w, "not allowed on your own account", 409)
+		return db.User{}, false
+	}
+	u, err := s.Q.UserByID(r.Context(), uid)
+	if err != nil {
+		http.Error(w, "not found", 404)
+		return db.User{}, false
+	}
+	return u, true
+}
+
+// AdminDisableUser blocks login and revokes the user's sessions and access
+// tokens. Pages and other data are kept.
+func (s *Service) AdminDisableUser(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.targetUser(w, r)
+	if !ok {
+		return
+	}
+	err := s.inTx(r.Context(), func(q *db.Queries) error {
+		if err := q.UserDisable(r.Context(), u.ID); err != nil {
+			return err
+		}
+		return q.AccessTokensDeleteByUser(r.Context(), u.ID)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	s.audit(r, "user.disable", "user", u.ID.String(), map[string]any{"disabled": u.DisabledAt.Valid}, map[string]any{"disabled": true})
+	writeJSON(w, r, map[string]string{"ok": "1"})
+}
+
+func (s *Service) AdminEnableUser(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.targetUser(w, r)
+	if !ok {
+		return
+	}
+	if err := s.Q.UserEnable(r.Context(), u.ID); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	s.audit(r, "user.enable", "user", u.ID.String(), map[string]any{"disabled": u.DisabledAt.Valid}, map[string]any{"disabled": false})
+	writeJSON(w, r, map[string]string{"ok": "1"})
+}
+
+// AdminForcePasswordReset clears the user's password, revokes their
+// sessions and access tokens and mails them a reset link.
+func (s *Service) AdminForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.targetUser(w, r)
+	if !ok {
+		return
+	}
+	err := s.inTx(r.Context(), func(q *db.Queries) error {
+		if err := q.UserSetPassword(r.Context(), db.UserSetPasswordParams{
+			Column1:  u.ID,
+			PassHash: noPassword,
+		}); err != nil {
+			return err
+		}
+		return q.AccessTokensDeleteByUser(r.Context(), u.ID)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	s.sendReset(r.Context(), u.ID, u.Email)
+	s.audit(r, "user.reset_password", "user", u.ID.String(), nil, nil)
+	writeJSON(w, r, map[string]string{"ok": "1"})
+}
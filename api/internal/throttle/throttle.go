@@ -0,0 +1,94 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter counts failures per key and makes the key wait before the next
+// attempt. The first Free failures cost nothing; after that the delay starts
+// at Base and doubles with every failure, up to Max. A key that has not
+// failed for Forget is cleared.
+type Limiter struct {
+	Free   int
+	Base   time.Duration
+	Max    time.Duration
+	Forget time.Duration
+
+	mu sync.Mutex
+	m  map[string]*entry
+}
+
+type entry struct {
+	fails int
+	last  time.Time
+	until time.Time
+}
+
+// maxKeys bounds memory use; stale keys are dropped once it is reached.
+const maxKeys = 100_000
+
+func New(free int, base, max, forget time.Duration) *Limiter {
+	return &Limiter{Free: free, Base: base, Max: max, Forget: forget, m: map[string]*entry{}}
+}
+
+// Wait returns how long key must wait before its next attempt, or 0.
+func (l *Limiter) Wait(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	e := l.get(key, now)
+	if e == nil || !now.Before(e.until) {
+		return 0
+	}
+	return e.until.Sub(now)
+}
+
+// Fail records a failed attempt for key.
+func (l *Limiter) Fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	e := l.get(key, now)
+	if e == nil {
+		if len(l.m) >= maxKeys {
+			l.prune(now)
+		}
+		e = &entry{}
+		l.m[key] = e
+	}
+	e.fails++
+	e.last = now
+	if n := e.fails - l.Free; n > 0 {
+		d := l.Base
+		for i := 1; i < n && d < l.Max; i++ {
+			d *= 2
+		}
+		if d > l.Max {
+			d = l.Max
+		}
+		e.until = now.Add(d)
+	}
+}
+
+// Reset forgets the failures of key.
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	delete(l.m, key)
+	l.mu.Unlock()
+}
+
+func (l *Limiter) get(key string, now time.Time) *entry {
+	e := l.m[key]
+	if e != nil && now.Sub(e.last) > l.Forget && !now.Before(e.until) {
+		delete(l.m, key)
+		return nil
+	}
+	return e
+}
+
+func (l *Limiter) prune(now time.Time) {
+	for k := range l.m {
+		l.get(k, now)
+	}
+}
@@ -0,0 +1,28 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	l := New(2, time.Second, 8*time.Second, time.Hour)
+	for i, want := range []time.Duration{
+		0, 0, // free
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second,
+		8 * time.Second, 8 * time.Second, // capped at Max
+	} {
+		l.Fail("k")
+		got := l.Wait("k")
+		if got > want || got < want-100*time.Millisecond {
+			t.Errorf("after %d failures: wait %v, want %v", i+1, got, want)
+		}
+	}
+	if got := l.Wait("other"); got != 0 {
+		t.Errorf("other key: wait %v", got)
+	}
+	l.Reset("k")
+	if got := l.Wait("k"); got != 0 {
+		t.Errorf("after Reset: wait %v", got)
+	}
+}
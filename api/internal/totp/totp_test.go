@@ -0,0 +1,61 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// secret is the RFC 6238 SHA-1 test key "12345678901234567890" in base32.
+const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The RFC 6238 appendix B vectors for SHA-1, cut to the last six digits.
+func TestCodeRFC6238(t *testing.T) {
+	for _, tc := range []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	} {
+		got, err := Code(secret, Step(time.Unix(tc.unix, 0)))
+		if err != nil || got != tc.want {
+			t.Errorf("T=%d: got %q, %v, want %q", tc.unix, got, err, tc.want)
+		}
+	}
+}
+
+func TestVerifySkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+	code := func(d int64) string {
+		c, err := Code(secret, step+d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	for _, tc := range []struct {
+		code string
+		skew int
+		step int64
+		ok   bool
+	}{
+		{code(0), 0, step, true},
+		{code(-1), 0, 0, false},
+		{code(-1), 1, step - 1, true},
+		{code(1), 1, step + 1, true},
+		{code(2), 1, 0, false},
+		{code(-2), 1, 0, false},
+		{" 050 471 ", 0, step, true},
+		{"05047", 1, 0, false},
+	} {
+		got, ok := Verify(secret, tc.code, now, tc.skew)
+		if ok != tc.ok || got != tc.step {
+			t.Errorf("Verify(%q, skew %d) = %d, %v, want %d, %v", tc.code, tc.skew, got, ok, tc.step, tc.ok)
+		}
+	}
+}
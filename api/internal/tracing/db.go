@@ -0,0 +1,77 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/tim/eureka/internal/db"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DB wraps a db.DBTX so that every query gets a client span named after
+// its sqlc query, such as "db PageUpdate". Spans of QueryContext end when
+// the query returns, before its rows are read.
+func DB(d db.DBTX) db.DBTX { return tracedDB{d} }
+
+type tracedDB struct {
+	db db.DBTX
+}
+
+func (t tracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuery(ctx, query)
+	res, err := t.db.ExecContext(ctx, query, args...)
+	endQuery(span, err)
+	return res, err
+}
+
+func (t tracedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := startQuery(ctx, query)
+	st, err := t.db.PrepareContext(ctx, query)
+	endQuery(span, err)
+	return st, err
+}
+
+func (t tracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuery(ctx, query)
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	endQuery(span, err)
+	return rows, err
+}
+
+func (t tracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuery(ctx, query)
+	row := t.db.QueryRowContext(ctx, query, args...)
+	endQuery(span, row.Err())
+	return row
+}
+
+// startQuery names the span from the "-- name: X :kind" line sqlc puts
+// first in each query.
+func startQuery(ctx context.Context, query string) (context.Context, trace.Span) {
+	name := "query"
+	text := query
+	if rest, ok := strings.CutPrefix(query, "-- name: "); ok {
+		line, body, _ := strings.Cut(rest, "\n")
+		name, _, _ = strings.Cut(line, " ")
+		text = body
+	}
+	return tracer.Start(ctx, "db "+name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.DBSystemPostgreSQL,
+		attribute.String("db.operation.name", name),
+		attribute.String("db.query.text", strings.TrimSpace(text)),
+	))
+}
+
+// endQuery ends span, marking it failed on errors other than no rows.
+func endQuery(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,104 @@
+// Package tracing sets up OpenTelemetry and records spans for HTTP
+// requests, SQL queries and other slow steps such as bcrypt.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tim/eureka/internal/buildinfo"
+	"github.com/tim/eureka/internal/config"
+	"github.com/tim/eureka/internal/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer follows the global provider, so spans started before Setup or
+// without it are no-ops.
+var tracer = otel.Tracer("github.com/tim/eureka")
+
+// Setup installs the W3C trace context propagator and, unless
+// c.Exporter is empty, a provider that exports spans. The returned
+// function flushes pending spans and must be called on shutdown.
+func Setup(ctx context.Context, c config.Tracing) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exp sdktrace.SpanExporter
+	var err error
+	switch c.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		var opts []otlptracehttp.Option
+		if c.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(c.Endpoint))
+		}
+		exp, err = otlptracehttp.New(ctx, opts...)
+	case "stdout":
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	default:
+		err = fmt.Errorf("unknown exporter %q", c.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName(c.ServiceName),
+		semconv.ServiceVersion(buildinfo.Version),
+	))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Start begins an internal span; the caller ends it.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// Middleware starts a server span for each request, continuing a trace
+// from the traceparent header when there is one. The span is named after
+// the chi route pattern and carries the X-Request-ID, so a request in the
+// logs or the audit log can be found in the traces; it must run after
+// middleware.RequestID.
+func Middleware(routes chi.Routes) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracer.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				attribute.String("http.request.id", middleware.GetRequestID(r.Context())),
+			))
+			defer span.End()
+
+			rec := middleware.Record(w)
+			next.ServeHTTP(rec, r.WithContext(ctx))
+
+			route := middleware.RoutePattern(routes, r)
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route), semconv.HTTPResponseStatusCode(rec.Status))
+			if rec.Status >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(rec.Status))
+			}
+		})
+	}
+}
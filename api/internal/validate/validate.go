@@ -0,0 +1,88 @@
+package validate
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+//go:embed common-passwords.txt
+var commonPasswords string
+
+var ErrEmail = errors.New("invalid email")
+
+// Email normalizes an address for storage and lookup: trimmed, lowercased,
+// without a display name.
+func Email(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	a, err := mail.ParseAddress(s)
+	if err != nil || a.Address != s || a.Name != "" || len(s) > 254 {
+		return "", ErrEmail
+	}
+	return s, nil
+}
+
+// PasswordPolicy holds the rules a new password must satisfy.
+type PasswordPolicy struct {
+	MinLength int // in characters
+	deny      map[string]bool
+}
+
+// maxPasswordBytes is the bcrypt input limit.
+const maxPasswordBytes = 72
+
+// DefaultPolicy returns a policy with the given minimum length and the
+// built-in list of common passwords.
+func DefaultPolicy(minLength int) PasswordPolicy {
+	p := PasswordPolicy{MinLength: minLength, deny: map[string]bool{}}
+	_ = p.addDenyList(strings.NewReader(commonPasswords))
+	return p
+}
+
+// LoadDenyList adds passwords from a file, one per line, to the deny list.
+func (p *PasswordPolicy) LoadDenyList(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return p.addDenyList(f)
+}
+
+func (p *PasswordPolicy) addDenyList(r io.Reader) error {
+	if p.deny == nil {
+		p.deny = map[string]bool{}
+	}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if w := strings.TrimSpace(sc.Text()); w != "" && !strings.HasPrefix(w, "#") {
+			p.deny[strings.ToLower(w)] = true
+		}
+	}
+	return sc.Err()
+}
+
+// Check returns a user-facing error if pw is not acceptable for the account
+// with the given email.
+func (p PasswordPolicy) Check(pw, email string) error {
+	if n := utf8.RuneCountInString(pw); n < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters", p.MinLength)
+	}
+	if len(pw) > maxPasswordBytes {
+		return fmt.Errorf("password must be at most %d bytes", maxPasswordBytes)
+	}
+	lower := strings.ToLower(pw)
+	if p.deny[lower] {
+		return errors.New("password is too common")
+	}
+	if local, _, ok := strings.Cut(strings.ToLower(email), "@"); ok && lower == local || lower == strings.ToLower(email) {
+		return errors.New("password must not match the email")
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package validate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEmail(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+		err      bool
+	}{
+		{"a@example.com", "a@example.com", false},
+		{"  Foo.Bar@Example.COM\n", "foo.bar@example.com", false},
+		{"Foo <foo@example.com>", "", true},
+		{"foo@example.com, bar@example.com", "", true},
+		{"no-at-sign", "", true},
+		{"", "", true},
+		{strings.Repeat("a", 250) + "@b.cd", "", true},
+	} {
+		got, err := Email(tc.in)
+		if got != tc.want || (err != nil) != tc.err {
+			t.Errorf("Email(%q) = %q, %v", tc.in, got, err)
+		}
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	p := DefaultPolicy(8)
+	p.addDenyList(strings.NewReader("# comment\nHunter2Hunter2\n"))
+	for _, tc := range []struct {
+		pw, email string
+		want      string // error message, "" when accepted
+	}{
+		{"correct horse", "a@b.cd", ""},
+		{"пароль12", "a@b.cd", ""}, // 8 characters, 14 bytes
+		{"short", "a@b.cd", "password must be at least 8 characters"},
+		{strings.Repeat("x", 73), "a@b.cd", "password must be at most 72 bytes"},
+		{"Password", "a@b.cd", "password is too common"},
+		{"hunter2hunter2", "a@b.cd", "password is too common"},
+		{"# comment", "a@b.cd", ""},
+		{"Alice.Smith", "alice.smith@b.cd", "password must not match the email"},
+		{"alice@b.cd", "Alice@B.cd", "password must not match the email"},
+	} {
+		err := p.Check(tc.pw, tc.email)
+		if got := errString(err); got != tc.want {
+			t.Errorf("Check(%q, %q) = %q, want %q", tc.pw, tc.email, got, tc.want)
+		}
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
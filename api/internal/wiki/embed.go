@@ -0,0 +1,168 @@
+package wiki
+
+import "strings"
+
+const (
+	maxEmbedDepth = 8
+	maxEmbeds     = 64
+)
+
+// Embed is a page that an ![[embed]] points at.
+type Embed struct {
+	ID   string
+	Body string
+}
+
+// EmbedFetcher looks up the target of an embed. ok is false when the page
+// does not exist or the viewer may not read it.
+type EmbedFetcher func(target string) (e Embed, ok bool)
+
+// Expand replaces ![[embeds]] in the body of page id with the embedded page
+// or section, recursively. Embeds that cannot be fetched, that would form a
+// cycle or that exceed the depth and count limits are left as written. If
+// wrap is non-nil, it is applied to the content of every expanded embed.
+func Expand(id, body string, fetch EmbedFetcher, wrap func(id, content string) string) string {
+	n := 0
+	return expand(body, []string{id}, fetch, wrap, &n)
+}
+
+func expand(body string, stack []string, fetch EmbedFetcher, wrap func(id, content string) string, n *int) string {
+	var out strings.Builder
+	last := 0
+	for _, l := range ParseLinks(body) {
+		if !l.Embed || l.Target == "" || len(stack) > maxEmbedDepth || *n >= maxEmbeds {
+			continue
+		}
+		e, ok := fetch(l.Target)
+		if !ok || contains(stack, e.ID) {
+			continue
+		}
+		content := e.Body
+		if l.Anchor != "" {
+			if content, ok = Section(e.Body, l.Anchor); !ok {
+				continue
+			}
+		}
+		*n++
+		content = expand(content, append(stack[:len(stack):len(stack)], e.ID), fetch, wrap, n)
+		if wrap != nil {
+			content = wrap(e.ID, content)
+		}
+		out.WriteString(body[last:l.Offset])
+		out.WriteString(content)
+		last = l.End
+	}
+	out.WriteString(body[last:])
+	return out.String()
+}
+
+func contains(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Section returns the part of body that anchor refers to: a heading with
+// everything up to the next heading of the same or a higher level, or the
+// paragraph ending in a ^blockid marker.
+func Section(body, anchor string) (string, bool) {
+	if strings.HasPrefix(anchor, "^") {
+		return block(body, anchor)
+	}
+	if i := strings.LastIndexByte(anchor, '#'); i >= 0 {
+		anchor = anchor[i+1:]
+	}
+	want := Slug(anchor)
+	start, level := -1, 0
+	for _, h := range headings(body) {
+		if start >= 0 && h.level <= level {
+			return strings.TrimRight(body[start:h.offset], "\n"), true
+		}
+		if start < 0 && Slug(h.text) == want {
+			start, level = h.offset, h.level
+		}
+	}
+	if start < 0 {
+		return "", false
+	}
+	return strings.TrimRight(body[start:], "\n"), true
+}
+
+type heading struct {
+	level  int
+	text   string
+	offset int
+}
+
+// headings lists the ATX headings of body outside fenced code blocks.
+func headings(body string) []heading {
+	var hs []heading
+	forEachLine(body, func(line string, off int) {
+		t := strings.TrimLeft(line, " ")
+		if len(line)-len(t) > 3 {
+			return
+		}
+		level := 0
+		for level < len(t) && t[level] == '#' {
+			level++
+		}
+		if level == 0 || level > 6 || (level < len(t) && t[level] != ' ' && t[level] != '\t') {
+			return
+		}
+		text := strings.TrimSpace(t[level:])
+		text = strings.TrimSpace(strings.TrimRight(text, "#"))
+		hs = append(hs, heading{level: level, text: text, offset: off})
+	})
+	return hs
+}
+
+// block returns the paragraph marked with the ^id block reference, without
+// the marker itself.
+func block(body, ref string) (string, bool) {
+	var (
+		found  string
+		ok     bool
+		para   []string
+		marked bool
+	)
+	end := func() {
+		if marked && !ok {
+			found, ok = strings.Join(para, "\n"), true
+		}
+		para, marked = nil, false
+	}
+	forEachLine(body, func(line string, _ int) {
+		if line == "" {
+			end()
+			return
+		}
+		t := strings.TrimRight(line, " \t")
+		marked = strings.HasSuffix(t, " "+ref) || t == ref
+		if marked {
+			line = strings.TrimRight(strings.TrimSuffix(t, ref), " \t")
+		}
+		para = append(para, line)
+	})
+	end()
+	return found, ok
+}
+
+// forEachLine calls fn with every line of body outside fenced code blocks,
+// without its line ending, and its byte offset. Paragraph breaks are passed
+// as a single empty line.
+func forEachLine(body string, fn func(line string, off int)) {
+	forEachProse(body, func(start, end int) {
+		for pos := start; pos < end; {
+			next := end
+			if i := strings.IndexByte(body[pos:end], '\n'); i >= 0 {
+				next = pos + i + 1
+			}
+			fn(strings.TrimRight(body[pos:next], "\r\n"), pos)
+			pos = next
+		}
+		fn("", end)
+	})
+}
@@ -0,0 +1,20 @@
+package wiki
+
+import "testing"
+
+func TestExpand(t *testing.T) {
+	pages := map[string]Embed{
+		"A": {ID: "a", Body: "a1 ![[B]]"},
+		"B": {ID: "b", Body: "b1 ![[A]] ![[C#Two]] ![[C^blk]]"},
+		"C": {ID: "c", Body: "# One\none\n## Two\ntwo\n# Three\n\npara ^blk\n\nlast"},
+	}
+	fetch := func(target string) (Embed, bool) {
+		e, ok := pages[target]
+		return e, ok
+	}
+	got := Expand("a", pages["A"].Body+" ![[Missing]]", fetch, nil)
+	want := "a1 b1 ![[A]] ## Two\ntwo para ![[Missing]]"
+	if got != want {
+		t.Errorf("Expand = %q, want %q", got, want)
+	}
+}
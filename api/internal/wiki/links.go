@@ -0,0 +1,233 @@
+package wiki
+
+import "strings"
+
+// Link is a single [[wiki link]] or ![[embed]] found in a page body.
+type Link struct {
+	Target string // page name, empty for [[#Heading]] links within the same page
+	Anchor string // heading, or ^blockid for block references
+	Alias  string // text after "|", if any
+	Embed  bool   // written as ![[...]]
+	Offset int    // byte offset of the opening "[[", or of "!" for embeds
+	End    int    // byte offset just past the closing "]]"
+}
+
+// ParseLinks extracts wiki links from a markdown body. Links inside fenced
+// code blocks and inline code spans are ignored, as are escaped brackets.
+func ParseLinks(body string) []Link {
+	var links []Link
+	forEachProse(body, func(start, end int) {
+		links = append(links, scanInline(body, start, end)...)
+	})
+	return links
+}
+
+// RenameLinks points every link whose target is a key of names at the
+// mapped name instead. Anchors, aliases and the embed marker are kept as
+// written. It returns the new body and whether anything changed.
+func RenameLinks(body string, names map[string]string) (string, bool) {
+	var out strings.Builder
+	last := 0
+	for _, l := range ParseLinks(body) {
+		to, ok := names[l.Target]
+		if !ok || l.Target == "" {
+			continue
+		}
+		start := l.Offset + 2
+		if l.Embed {
+			start++
+		}
+		start += strings.Index(body[start:l.End], l.Target)
+		out.WriteString(body[last:start])
+		out.WriteString(to)
+		last = start + len(l.Target)
+	}
+	if last == 0 {
+		return body, false
+	}
+	out.WriteString(body[last:])
+	return out.String(), true
+}
+
+// forEachProse calls fn with the byte ranges of body that are not inside a
+// fenced code block. Each range is a run of lines forming one or more
+// paragraphs, so inline code spans never cross a range boundary.
+func forEachProse(body string, fn func(start, end int)) {
+	var (
+		fenceChar byte
+		fenceLen  int
+		start     = -1
+	)
+	flush := func(end int) {
+		if start >= 0 && end > start {
+			fn(start, end)
+		}
+		start = -1
+	}
+	for pos := 0; pos < len(body); {
+		eol := strings.IndexByte(body[pos:], '\n')
+		next := len(body)
+		if eol >= 0 {
+			next = pos + eol + 1
+		}
+		line := body[pos:next]
+
+		if fenceLen > 0 {
+			if c, n, rest := fence(line); c == fenceChar && n >= fenceLen && strings.TrimSpace(rest) == "" {
+				fenceLen = 0
+			}
+			pos = next
+			continue
+		}
+		if c, n, rest := fence(line); n > 0 && !(c == '`' && strings.IndexByte(rest, '`') >= 0) {
+			flush(pos)
+			fenceChar, fenceLen = c, n
+			pos = next
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			flush(pos)
+		} else if start < 0 {
+			start = pos
+		}
+		pos = next
+	}
+	if fenceLen == 0 {
+		flush(len(body))
+	}
+}
+
+// fence reports the fence character and length if line opens or closes a
+// fenced code block, along with the remainder of the line.
+func fence(line string) (byte, int, string) {
+	i := 0
+	for i < len(line) && i < 3 && line[i] == ' ' {
+		i++
+	}
+	if i >= len(line) || (line[i] != '`' && line[i] != '~') {
+		return 0, 0, ""
+	}
+	c := line[i]
+	n := 0
+	for i+n < len(line) && line[i+n] == c {
+		n++
+	}
+	if n < 3 {
+		return 0, 0, ""
+	}
+	return c, n, line[i+n:]
+}
+
+func scanInline(body string, start, end int) []Link {
+	var links []Link
+	for i := start; i < end; {
+		switch {
+		case body[i] == '\\' && i+1 < end && isPunct(body[i+1]):
+			i += 2
+		case body[i] == '`':
+			n := run(body, i, end, '`')
+			if close := findRun(body, i+n, end, '`', n); close >= 0 {
+				i = close + n
+			} else {
+				i += n
+			}
+		case strings.HasPrefix(body[i:end], "![["):
+			if l, ok := parseLink(body, i+1, end); ok {
+				l.Embed, l.Offset = true, i
+				links = append(links, l)
+				i = l.End
+			} else {
+				i += 3
+			}
+		case strings.HasPrefix(body[i:end], "[["):
+			if l, ok := parseLink(body, i, end); ok {
+				links = append(links, l)
+				i = l.End
+			} else {
+				i += 2
+			}
+		default:
+			i++
+		}
+	}
+	return links
+}
+
+// parseLink parses a link whose "[[" starts at off. The link must close on
+// the same line and cannot contain another "[[".
+func parseLink(body string, off, end int) (Link, bool) {
+	var inner strings.Builder
+	for i := off + 2; i < end; i++ {
+		switch c := body[i]; {
+		case c == '\n':
+			return Link{}, false
+		case c == '\\' && i+1 < end && body[i+1] == '|':
+			// \| is how a link alias is written inside a markdown table.
+			inner.WriteByte('|')
+			i++
+		case c == '[' && i+1 < end && body[i+1] == '[':
+			return Link{}, false
+		case c == ']' && i+1 < end && body[i+1] == ']':
+			l := splitLink(inner.String())
+			if l.Target == "" && l.Anchor == "" {
+				return Link{}, false
+			}
+			l.Offset, l.End = off, i+2
+			return l, true
+		default:
+			inner.WriteByte(c)
+		}
+	}
+	return Link{}, false
+}
+
+// splitLink splits "Target#Anchor|Alias" into its parts. Block references
+// may be written as Target^id or Target#^id.
+func splitLink(s string) Link {
+	var l Link
+	if i := strings.IndexByte(s, '|'); i >= 0 {
+		l.Alias = strings.TrimSpace(s[i+1:])
+		s = s[:i]
+	}
+	if i := strings.IndexAny(s, "#^"); i >= 0 {
+		anchor := s[i:]
+		s = s[:i]
+		if anchor[0] == '#' {
+			anchor = anchor[1:]
+		}
+		l.Anchor = strings.TrimSpace(anchor)
+		if l.Anchor == "^" {
+			l.Anchor = ""
+		}
+	}
+	l.Target = strings.TrimSpace(s)
+	return l
+}
+
+func run(s string, i, end int, c byte) int {
+	n := 0
+	for i+n < end && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// findRun returns the offset of the next run of exactly n c bytes.
+func findRun(s string, i, end int, c byte, n int) int {
+	for i < end {
+		if s[i] != c {
+			i++
+			continue
+		}
+		m := run(s, i, end, c)
+		if m == n {
+			return i
+		}
+		i += m
+	}
+	return -1
+}
+
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
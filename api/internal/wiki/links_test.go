@@ -0,0 +1,92 @@
+package wiki
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLinks(t *testing.T) {
+	tests := []struct {
+		body string
+		want []Link
+	}{
+		{"see [[Page]]", []Link{{Target: "Page", Offset: 4, End: 12}}},
+		{"[[ Page | shown ]]", []Link{{Target: "Page", Alias: "shown", Offset: 0, End: 18}}},
+		{"[[Page#Intro]]", []Link{{Target: "Page", Anchor: "Intro", End: 14}}},
+		{"[[Page^abc]]", []Link{{Target: "Page", Anchor: "^abc", End: 12}}},
+		{"[[Page#^abc|x]]", []Link{{Target: "Page", Anchor: "^abc", Alias: "x", End: 15}}},
+		{"[[#Local]]", []Link{{Anchor: "Local", End: 10}}},
+		{"| [[A\\|b]] |", []Link{{Target: "A", Alias: "b", Offset: 2, End: 10}}},
+		{"`[[A]]` [[B]]", []Link{{Target: "B", Offset: 8, End: 13}}},
+		{"``x ` [[A]]`` [[B]]", []Link{{Target: "B", Offset: 14, End: 19}}},
+		{"`open [[A]]", []Link{{Target: "A", Offset: 6, End: 11}}},
+		{"\\[[A]] [[B]]", []Link{{Target: "B", Offset: 7, End: 12}}},
+		{"```\n[[A]]\n```\n[[B]]", []Link{{Target: "B", Offset: 14, End: 19}}},
+		{"~~~~\n[[A]]\n~~~\n[[B]]\n~~~~\n[[C]]", []Link{{Target: "C", Offset: 26, End: 31}}},
+		{"```\n[[A]]", nil},
+		{"[[A\n]]", nil},
+		{"[[]] [[ | x]]", nil},
+		{"[[a [[B]]", []Link{{Target: "B", Offset: 4, End: 9}}},
+		{"![[A#Part]] \\![[B]]", []Link{{Target: "A", Anchor: "Part", Embed: true, End: 11}, {Target: "B", Offset: 14, End: 19}}},
+	}
+	for _, tt := range tests {
+		got := ParseLinks(tt.body)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseLinks(%q) = %+v, want %+v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestRenameLinks(t *testing.T) {
+	names := map[string]string{"A": "A (bob)", "B c": "D"}
+	tests := []struct {
+		body, want string
+	}{
+		{"[[A]] and [[Ab]]", "[[A (bob)]] and [[Ab]]"},
+		{"[[ A #Part| x]]", "[[ A (bob) #Part| x]]"},
+		{"![[A^id]] | [[B c\\|alias]] |", "![[A (bob)^id]] | [[D\\|alias]] |"},
+		{"`[[A]]` [[#A]]", "`[[A]]` [[#A]]"},
+	}
+	for _, tt := range tests {
+		got, changed := RenameLinks(tt.body, names)
+		if got != tt.want || changed != (tt.body != tt.want) {
+			t.Errorf("RenameLinks(%q) = %q, %v, want %q", tt.body, got, changed, tt.want)
+		}
+	}
+}
+
+func FuzzParseLinks(f *testing.F) {
+	for _, s := range []string{
+		"[[Page]]",
+		"[[Page#Heading|Alias]] and [[Other^block]]",
+		"```go\n[[Code]]\n```\n`[[Inline]]` \\[[Escaped]]",
+		"| [[A\\|b]] |",
+		"~~~\n[[x]]",
+		"![[Embed#Section]] !![[x]]",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, body string) {
+		prev := 0
+		for _, l := range ParseLinks(body) {
+			if l.Offset < prev || l.End <= l.Offset || l.End > len(body) {
+				t.Fatalf("bad range [%d,%d) after %d in %q", l.Offset, l.End, prev, body)
+			}
+			raw := body[l.Offset:l.End]
+			if l.Embed {
+				raw = strings.TrimPrefix(raw, "!")
+			}
+			if !strings.HasPrefix(raw, "[[") || !strings.HasSuffix(raw, "]]") || strings.Contains(raw, "\n") {
+				t.Fatalf("range %q is not a link", raw)
+			}
+			if l.Target == "" && l.Anchor == "" {
+				t.Fatalf("empty link %q", raw)
+			}
+			if strings.ContainsAny(l.Target, "|#^") {
+				t.Fatalf("target %q not split in %q", l.Target, raw)
+			}
+			prev = l.End
+		}
+	})
+}
@@ -0,0 +1,179 @@
+package wiki
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Resolver maps a link target to a page ID. ok is false for missing pages.
+type Resolver func(target string) (id string, ok bool)
+
+var md = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(
+		parser.WithAutoHeadingID(),
+		parser.WithASTTransformers(util.Prioritized(imageRewriter{}, 100)),
+	),
+	goldmark.WithRendererOptions(gmhtml.WithUnsafe()),
+)
+
+var policy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^wiki-link( wiki-link-missing)?$`)).OnElements("a", "span")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^wiki-embed$`)).OnElements("div")
+	p.AllowAttrs("data-page-id").Matching(regexp.MustCompile(`^[0-9a-f-]{36}$`)).OnElements("a", "div")
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)).OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	return p
+}()
+
+// Render converts a page body to sanitized HTML. Wiki links to existing
+// pages become anchors carrying the page ID, the rest are marked missing,
+// and image URLs served by this API are made relative.
+func Render(body string, resolve Resolver) (string, error) {
+	var src strings.Builder
+	last := 0
+	for _, l := range ParseLinks(body) {
+		src.WriteString(body[last:l.Offset])
+		src.WriteString(linkHTML(l, resolve))
+		last = l.End
+	}
+	src.WriteString(body[last:])
+
+	var out bytes.Buffer
+	ctx := parser.NewContext(parser.WithIDs(&headingIDs{seen: map[string]bool{}}))
+	if err := md.Convert([]byte(src.String()), &out, parser.WithContext(ctx)); err != nil {
+		return "", err
+	}
+	return policy.Sanitize(out.String()), nil
+}
+
+func linkHTML(l Link, resolve Resolver) string {
+	label := l.Alias
+	if label == "" {
+		label = l.Target
+		if l.Anchor != "" {
+			if label != "" {
+				label += " > "
+			}
+			label += l.Anchor
+		}
+	}
+	label = escapeText(label)
+
+	frag := ""
+	if l.Anchor != "" {
+		frag = "#" + fragment(l.Anchor)
+	}
+	if l.Target == "" {
+		return `<a class="wiki-link" href="` + frag + `">` + label + `</a>`
+	}
+	id, ok := resolve(l.Target)
+	if !ok {
+		return `<span class="wiki-link wiki-link-missing" title="` + html.EscapeString(l.Target) + `">` + label + `</span>`
+	}
+	id = html.EscapeString(id)
+	return `<a class="wiki-link" href="/view/` + id + frag + `" data-page-id="` + id + `">` + label + `</a>`
+}
+
+// fragment returns the URL fragment for a link anchor. Nested headings
+// (Page#A#B) point at the innermost one.
+func fragment(anchor string) string {
+	if strings.HasPrefix(anchor, "^") {
+		return anchor
+	}
+	if i := strings.LastIndexByte(anchor, '#'); i >= 0 {
+		anchor = anchor[i+1:]
+	}
+	return Slug(anchor)
+}
+
+// WrapEmbed marks up the content of an expanded embed for Render. Use it as
+// the wrap function of Expand.
+func WrapEmbed(id, content string) string {
+	return "\n\n<div class=\"wiki-embed\" data-page-id=\"" + html.EscapeString(id) + "\">\n\n" + content + "\n\n</div>\n\n"
+}
+
+// escapeText makes s safe to splice into markdown source as literal text.
+func escapeText(s string) string {
+	s = html.EscapeString(s)
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte("\\`*_[]!~|", s[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// Slug returns the heading ID that Render assigns to a heading with the
+// given text, so clients can build links to sections.
+func Slug(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(r)
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// headingIDs implements parser.IDs with Slug, which unlike the goldmark
+// default keeps non-ASCII letters.
+type headingIDs struct {
+	seen map[string]bool
+}
+
+func (h *headingIDs) Generate(value []byte, _ ast.NodeKind) []byte {
+	base := Slug(string(value))
+	if base == "" {
+		base = "heading"
+	}
+	id := base
+	for n := 1; h.seen[id]; n++ {
+		id = base + "-" + strconv.Itoa(n)
+	}
+	h.seen[id] = true
+	return []byte(id)
+}
+
+func (h *headingIDs) Put(value []byte) {
+	h.seen[string(value)] = true
+}
+
+var apiImage = regexp.MustCompile(`(?:^|/)api/images/([0-9a-fA-F-]{36})$`)
+
+// imageRewriter points images uploaded to this API at /api/images/{id},
+// whatever host the editor inserted them with.
+type imageRewriter struct{}
+
+func (imageRewriter) Transform(doc *ast.Document, _ text.Reader, _ parser.Context) {
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if img, ok := n.(*ast.Image); ok && entering {
+			if m := apiImage.FindSubmatch(img.Destination); m != nil {
+				img.Destination = append([]byte("/api/images/"), bytes.ToLower(m[1])...)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+}
@@ -0,0 +1,105 @@
+package wiki
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const homeID = "0f8fad5b-d9cb-469f-a165-70867728950e"
+
+func resolveHome(target string) (string, bool) {
+	if target == "Home" {
+		return homeID, true
+	}
+	return "", false
+}
+
+// unsafeHTML matches a script element or an event handler attribute.
+var unsafeHTML = regexp.MustCompile(`(?i)<script|<[^>]*\son\w+\s*=`)
+
+func TestRenderInjection(t *testing.T) {
+	for _, body := range []string{
+		`[[Home|<script>alert(1)</script>]]`,
+		`[[Home|x" onmouseover="alert(1)]]`,
+		`[[Home#"><img src=x onerror=alert(1)>]]`,
+		`[[Home#x" onclick="alert(1)|y]]`,
+		`[[<img src=x onerror=alert(1)>]]`,
+		`[[Nope" onmouseover="alert(1)]]`,
+		`[[#"><script>alert(1)</script>]]`,
+	} {
+		got, err := Render(body, resolveHome)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if unsafeHTML.MatchString(got) {
+			t.Errorf("Render(%q) = %q", body, got)
+		}
+	}
+}
+
+func TestRenderLinks(t *testing.T) {
+	tests := []struct {
+		body, want string
+	}{
+		{"[[Home]]", `<a class="wiki-link" href="/view/` + homeID + `" data-page-id="` + homeID + `" rel="nofollow">Home</a>`},
+		{"[[Home#Intro|see]]", `href="/view/` + homeID + `#intro"`},
+		{"[[Home#A#Sub Part]]", `href="/view/` + homeID + `#sub-part"`},
+		{"[[#Local]]", `<a class="wiki-link" href="#local" rel="nofollow">Local</a>`},
+		{"[[Nope]]", `<span class="wiki-link wiki-link-missing" title="Nope">Nope</span>`},
+		{"[[Nope|shown]]", `<span class="wiki-link wiki-link-missing" title="Nope">shown</span>`},
+	}
+	for _, tt := range tests {
+		got, err := Render(tt.body, resolveHome)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, tt.want) {
+			t.Errorf("Render(%q) = %q, want it to contain %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestRenderImages(t *testing.T) {
+	tests := []struct {
+		body, want string
+	}{
+		{"![a](https://wiki.example.com/api/images/0F8FAD5B-D9CB-469F-A165-70867728950E)", `src="/api/images/` + homeID + `"`},
+		{"![a](http://localhost:8080/api/images/" + homeID + ")", `src="/api/images/` + homeID + `"`},
+		{"![a](api/images/" + homeID + ")", `src="/api/images/` + homeID + `"`},
+		{"![a](https://other.example/x.png)", `src="https://other.example/x.png"`},
+		{"![a](https://other.example/api/images/" + homeID + "/raw)", `src="https://other.example/api/images/` + homeID + `/raw"`},
+	}
+	for _, tt := range tests {
+		got, err := Render(tt.body, resolveHome)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, tt.want) {
+			t.Errorf("Render(%q) = %q, want it to contain %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestRenderHeadingIDs(t *testing.T) {
+	got, err := Render("# Привет, мир\n\n## Intro\n\n## Intro\n\n## !!!\n\n## <b onclick=x>Bold</b>\n", resolveHome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<h1 id="привет-мир">`,
+		`<h2 id="intro">`,
+		`<h2 id="intro-1">`,
+		`<h2 id="heading">`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %s in %q", want, got)
+		}
+	}
+	if unsafeHTML.MatchString(got) {
+		t.Errorf("unsafe HTML in %q", got)
+	}
+	if Slug("Привет, мир") != "привет-мир" {
+		t.Errorf("Slug does not match the heading ID: %q", Slug("Привет, мир"))
+	}
+}
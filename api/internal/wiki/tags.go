@@ -0,0 +1,116 @@
+package wiki
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tag is a #tag or #nested/tag found in a page body.
+type Tag struct {
+	Name   string // lowercased, without the leading "#"
+	Offset int    // byte offset of the "#"
+	End    int    // byte offset just past the tag
+}
+
+// ParseTags extracts hashtags from a markdown body. A tag starts with "#"
+// at the beginning of a word and must contain a non-digit. Hashtags inside
+// code and wiki links are ignored.
+func ParseTags(body string) []Tag {
+	var tags []Tag
+	forEachProse(body, func(start, end int) {
+		for i := start; i < end; {
+			switch {
+			case body[i] == '\\' && i+1 < end && isPunct(body[i+1]):
+				i += 2
+			case body[i] == '`':
+				n := run(body, i, end, '`')
+				if close := findRun(body, i+n, end, '`', n); close >= 0 {
+					i = close + n
+				} else {
+					i += n
+				}
+			case strings.HasPrefix(body[i:end], "[["):
+				if l, ok := parseLink(body, i, end); ok {
+					i = l.End
+				} else {
+					i += 2
+				}
+			case body[i] == '#' && wordStart(body, i):
+				if t, ok := parseTag(body, i, end); ok {
+					tags = append(tags, t)
+					i = t.End
+				} else {
+					i++
+				}
+			default:
+				i++
+			}
+		}
+	})
+	return tags
+}
+
+// ValidTag reports whether name, without the leading "#", is a tag that
+// ParseTags would find.
+func ValidTag(name string) bool {
+	t, ok := parseTag("#"+name, 0, len(name)+1)
+	return ok && t.End == len(name)+1
+}
+
+func parseTag(body string, off, end int) (Tag, bool) {
+	i := off + 1
+	digits := true
+	for i < end {
+		r, n := utf8.DecodeRuneInString(body[i:end])
+		if !isTagRune(r) {
+			break
+		}
+		if !unicode.IsDigit(r) && r != '/' {
+			digits = false
+		}
+		i += n
+	}
+	name := strings.Trim(body[off+1:i], "/")
+	if name == "" || digits || strings.Contains(name, "//") {
+		return Tag{}, false
+	}
+	return Tag{Name: strings.ToLower(name), Offset: off, End: off + 1 + len(strings.TrimRight(body[off+1:i], "/"))}, true
+}
+
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '/'
+}
+
+func wordStart(body string, i int) bool {
+	if i == 0 {
+		return true
+	}
+	r, _ := utf8.DecodeLastRuneInString(body[:i])
+	return unicode.IsSpace(r)
+}
+
+// HasTag reports whether tag is name or one of its nested children.
+func HasTag(tag, name string) bool {
+	return tag == name || strings.HasPrefix(tag, name+"/")
+}
+
+// RenameTag rewrites every occurrence of tag from, and its nested children,
+// to tag to. It returns the new body and whether anything changed.
+func RenameTag(body, from, to string) (string, bool) {
+	var out strings.Builder
+	last := 0
+	for _, t := range ParseTags(body) {
+		if !HasTag(t.Name, from) {
+			continue
+		}
+		out.WriteString(body[last:t.Offset])
+		out.WriteString("#" + to + t.Name[len(from):])
+		last = t.End
+	}
+	if last == 0 {
+		return body, false
+	}
+	out.WriteString(body[last:])
+	return out.String(), true
+}
@@ -0,0 +1,21 @@
+package wiki
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	body := "#Top and #a/b/ #123 x#no `#code` [[P#h]] \\#esc\n# Heading #2024-q1\n```\n#fenced\n```"
+	var got []string
+	for _, tag := range ParseTags(body) {
+		got = append(got, tag.Name)
+	}
+	want := []string{"top", "a/b", "2024-q1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseTags = %q, want %q", got, want)
+	}
+	if out, _ := RenameTag("#a #a/b #ab", "a", "z"); out != "#z #z/b #ab" {
+		t.Errorf("RenameTag = %q", out)
+	}
+}
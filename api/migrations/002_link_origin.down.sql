@@ -0,0 +1,3 @@
+ALTER TABLE page_links DROP COLUMN IF EXISTS origin;
+
+DROP TYPE IF EXISTS link_origin;
@@ -0,0 +1,13 @@
+CREATE TYPE link_origin AS ENUM ('manual','parsed');
+
+ALTER TABLE page_links ADD COLUMN origin link_origin NOT NULL DEFAULT 'manual';
+
+-- Разобранной считаем только ссылку без тега, у которой в теле исходной
+-- страницы есть [[имя]] страницы назначения: синхронизация создаст её заново.
+-- Остальные остаются ручными, чтобы синхронизация их не удалила.
+UPDATE page_links l SET origin='parsed'
+FROM pages s, pages d
+WHERE s.id=l.id_source AND d.id=l.id_dest AND l.tag IS NULL
+  AND (position('[[' || d.name || ']]' IN s.body) > 0
+    OR position('[[' || d.name || '|' IN s.body) > 0
+    OR position('[[' || d.name || '#' IN s.body) > 0);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS uniq_link;
+DELETE FROM page_links a USING page_links b
+WHERE a.id_source=b.id_source AND a.id_dest=b.id_dest AND a.id > b.id;
+ALTER TABLE page_links ADD CONSTRAINT uniq_link UNIQUE (id_source,id_dest);
+
+ALTER TABLE page_links DROP COLUMN IF EXISTS anchor;
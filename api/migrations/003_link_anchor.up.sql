@@ -0,0 +1,5 @@
+ALTER TABLE page_links ADD COLUMN anchor TEXT;
+
+-- Одна страница может ссылаться на разные разделы другой
+ALTER TABLE page_links DROP CONSTRAINT uniq_link;
+CREATE UNIQUE INDEX uniq_link ON page_links (id_source, id_dest, COALESCE(anchor, ''));
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS uniq_link;
+DELETE FROM page_links a USING page_links b
+WHERE a.id_source=b.id_source AND a.id_dest=b.id_dest
+  AND COALESCE(a.anchor,'')=COALESCE(b.anchor,'') AND a.id > b.id;
+CREATE UNIQUE INDEX uniq_link ON page_links (id_source, id_dest, COALESCE(anchor, ''));
@@ -0,0 +1,3 @@
+-- Ссылка и встраивание одной и той же страницы хранятся отдельно (tag='embed')
+DROP INDEX uniq_link;
+CREATE UNIQUE INDEX uniq_link ON page_links (id_source, id_dest, COALESCE(anchor, ''), COALESCE(tag, ''));
@@ -0,0 +1,6 @@
+CREATE TABLE page_tags (
+  page_id UUID NOT NULL REFERENCES pages(id) ON DELETE CASCADE,
+  tag TEXT NOT NULL,
+  PRIMARY KEY (page_id, tag)
+);
+CREATE INDEX ON page_tags(tag);
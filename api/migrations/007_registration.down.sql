@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS invites;
+DROP TABLE IF EXISTS email_verifications;
+
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
+DROP INDEX IF EXISTS users_email_lower;
@@ -0,0 +1,43 @@
+-- Email сравнивается без учёта регистра. Если адреса совпадают без учёта
+-- регистра и пробелов, миграция перечисляет их и останавливается, ничего не
+-- изменив: такие аккаунты надо сначала объединить или переименовать вручную.
+DO $$
+DECLARE
+  dups TEXT;
+BEGIN
+  SELECT string_agg(e, ', ' ORDER BY e) INTO dups FROM (
+    SELECT lower(btrim(email)) AS e FROM users GROUP BY 1 HAVING count(*) > 1
+  ) d;
+  IF dups IS NOT NULL THEN
+    RAISE EXCEPTION 'emails that differ only in case or spaces: %', dups
+      USING HINT = 'merge or rename these accounts, then run the migration again';
+  END IF;
+END $$;
+UPDATE users SET email=lower(btrim(email));
+CREATE UNIQUE INDEX users_email_lower ON users (lower(email));
+
+-- Существующие аккаунты считаются подтверждёнными
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
+UPDATE users SET email_verified_at=now();
+
+CREATE TABLE email_verifications (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  token_hash TEXT UNIQUE NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX ON email_verifications(user_id);
+
+-- Приглашения для режима регистрации invite
+CREATE TABLE invites (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  code_hash TEXT UNIQUE NOT NULL,
+  note TEXT NOT NULL DEFAULT '',
+  created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  expires_at TIMESTAMPTZ,
+  used_at TIMESTAMPTZ,
+  used_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,3 @@
+-- Счётчик неудачных входов и временная блокировка аккаунта
+ALTER TABLE users ADD COLUMN failed_logins INT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN locked_until TIMESTAMPTZ;
@@ -0,0 +1,14 @@
+CREATE TYPE token_scope AS ENUM ('read','write');
+
+-- Персональные токены для скриптов; хранится только sha256 токена
+CREATE TABLE access_tokens (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  token_hash TEXT UNIQUE NOT NULL,
+  scope token_scope NOT NULL DEFAULT 'read',
+  expires_at TIMESTAMPTZ,
+  last_used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX ON access_tokens(user_id);
@@ -0,0 +1,8 @@
+-- Значения enum нельзя удалить, поэтому тип пересоздаётся
+UPDATE users SET role='user' WHERE role NOT IN ('user','adm');
+ALTER TABLE users ALTER COLUMN role DROP DEFAULT;
+ALTER TYPE user_role RENAME TO user_role_old;
+CREATE TYPE user_role AS ENUM ('user','adm');
+ALTER TABLE users ALTER COLUMN role TYPE user_role USING role::text::user_role;
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'user';
+DROP TYPE user_role_old;
@@ -0,0 +1,5 @@
+-- Встроенные роли; права каждой роли описаны в internal/auth/perm.go.
+-- user и adm сохраняют прежнее поведение.
+ALTER TYPE user_role ADD VALUE IF NOT EXISTS 'viewer';
+ALTER TYPE user_role ADD VALUE IF NOT EXISTS 'moderator';
+ALTER TYPE user_role ADD VALUE IF NOT EXISTS 'auditor';
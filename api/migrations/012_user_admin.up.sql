@@ -0,0 +1,3 @@
+-- Отключённый аккаунт сохраняет данные, но не может войти
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN last_login_at TIMESTAMPTZ;
@@ -0,0 +1,5 @@
+DROP TABLE archived_images;
+DROP TABLE archived_pages;
+ALTER TABLE pages DROP CONSTRAINT pages_user_id_fkey;
+ALTER TABLE pages ADD CONSTRAINT pages_user_id_fkey
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
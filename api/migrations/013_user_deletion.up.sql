@@ -0,0 +1,30 @@
+-- Удаление пользователя больше не уносит его страницы каскадом:
+-- их нужно передать, заархивировать или удалить явно
+ALTER TABLE pages DROP CONSTRAINT pages_user_id_fkey;
+ALTER TABLE pages ADD CONSTRAINT pages_user_id_fkey
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT;
+
+-- Архив страниц удалённых пользователей
+CREATE TABLE archived_pages (
+  id UUID PRIMARY KEY,                    -- id страницы до архивации
+  owner_id UUID NOT NULL,
+  owner_email TEXT NOT NULL,
+  name TEXT NOT NULL,
+  body TEXT NOT NULL,
+  links JSONB NOT NULL DEFAULT '[]',      -- исходящие ссылки на момент архивации
+  created_at TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL,
+  archived_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX ON archived_pages(owner_id);
+
+CREATE TABLE archived_images (
+  id UUID PRIMARY KEY,
+  page_id UUID NOT NULL REFERENCES archived_pages(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  mime TEXT NOT NULL,
+  size_bytes INT NOT NULL,
+  content BYTEA NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX ON archived_images(page_id);
@@ -0,0 +1,26 @@
+-- Журнал действий администраторов. Только добавление: строки нельзя
+-- изменить или удалить. Ссылок на users нет, чтобы записи переживали
+-- удаление пользователей.
+CREATE TABLE audit_events (
+  id BIGSERIAL PRIMARY KEY,
+  at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  actor_id UUID,
+  actor_email TEXT NOT NULL DEFAULT '',
+  action TEXT NOT NULL,                   -- например page.delete, user.role
+  target_type TEXT NOT NULL,
+  target_id TEXT NOT NULL DEFAULT '',
+  request_id TEXT NOT NULL DEFAULT '',
+  ip TEXT NOT NULL DEFAULT '',
+  before JSONB NOT NULL DEFAULT 'null',   -- состояние до и после действия
+  after JSONB NOT NULL DEFAULT 'null'
+);
+CREATE INDEX ON audit_events(at);
+CREATE INDEX ON audit_events(actor_id, id);
+CREATE INDEX ON audit_events(target_id, id);
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN RAISE EXCEPTION 'audit_events is append-only'; END; $$ LANGUAGE plpgsql;
+CREATE TRIGGER trg_audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+CREATE TRIGGER trg_audit_events_no_truncate BEFORE TRUNCATE ON audit_events
+FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
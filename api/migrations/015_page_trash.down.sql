@@ -0,0 +1,2 @@
+DELETE FROM pages WHERE deleted_at IS NOT NULL;
+ALTER TABLE pages DROP COLUMN deleted_at;
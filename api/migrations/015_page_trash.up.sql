@@ -0,0 +1,3 @@
+-- Корзина: удалённые страницы помечаются и очищаются позже
+ALTER TABLE pages ADD COLUMN deleted_at TIMESTAMPTZ;
+CREATE INDEX ON pages(deleted_at) WHERE deleted_at IS NOT NULL;
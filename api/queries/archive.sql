@@ -0,0 +1,19 @@
+-- name: PagesArchiveByUser :exec
+INSERT INTO archived_pages (id, owner_id, owner_email, name, body, links, created_at, updated_at)
+SELECT p.id, p.user_id, u.email, p.name, p.body,
+  COALESCE((SELECT jsonb_agg(jsonb_build_object('dest', l.id_dest, 'tag', l.tag, 'anchor', l.anchor, 'origin', l.origin))
+            FROM page_links l WHERE l.id_source=p.id), '[]'),
+  p.created_at, p.updated_at
+FROM pages p JOIN users u ON u.id=p.user_id
+WHERE p.user_id=$1::uuid;
+
+-- name: ImagesArchiveByUser :exec
+INSERT INTO archived_images (id, page_id, name, mime, size_bytes, content, created_at)
+SELECT i.id, i.page_id, i.name, i.mime, i.size_bytes, i.content, i.created_at
+FROM images i JOIN pages p ON p.id=i.page_id
+WHERE p.user_id=$1::uuid;
+
+-- name: ArchivedPagesList :many
+SELECT id::text, owner_email, name, updated_at, archived_at
+FROM archived_pages
+ORDER BY archived_at DESC, name;
@@ -0,0 +1,15 @@
+-- name: AuditEventCreate :exec
+INSERT INTO audit_events (actor_id, actor_email, action, target_type, target_id, request_id, ip, before, after)
+VALUES ($1, COALESCE((SELECT email FROM users WHERE id=$1), ''), $2, $3, $4, $5, $6, $7, $8);
+
+-- name: AuditEventsList :many
+SELECT id, at, actor_id, actor_email, action, target_type, target_id, request_id, ip, before, after
+FROM audit_events
+WHERE (sqlc.arg(action)::text = '' OR action = sqlc.arg(action) OR action LIKE sqlc.arg(action) || '.%')
+  AND (sqlc.arg(actor)::text = '' OR actor_id::text = sqlc.arg(actor))
+  AND (sqlc.arg(target)::text = '' OR target_id = sqlc.arg(target))
+  AND (sqlc.narg(since)::timestamptz IS NULL OR at >= sqlc.narg(since))
+  AND (sqlc.narg(until)::timestamptz IS NULL OR at < sqlc.narg(until))
+  AND (sqlc.arg(before_id)::bigint = 0 OR id < sqlc.arg(before_id))
+ORDER BY id DESC
+LIMIT sqlc.arg(lim);
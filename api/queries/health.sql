@@ -0,0 +1,2 @@
+-- name: ImagesReachable :exec
+SELECT 1 FROM images LIMIT 1;
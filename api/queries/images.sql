@@ -4,7 +4,9 @@ VALUES ($1::uuid,$2,$3,$4,$5)
 RETURNING id::text;
 
 -- name: ImageByID :one
-SELECT id::text, page_id::text, name, mime, size_bytes, content FROM images WHERE id=$1::uuid;
+SELECT i.id::text, i.page_id::text, i.name, i.mime, i.size_bytes, i.content
+FROM images i JOIN pages p ON p.id=i.page_id
+WHERE i.id=$1::uuid AND p.deleted_at IS NULL;
 
 -- name: ImagesByPage :many
 SELECT id::text, name, mime, size_bytes, created_at FROM images WHERE page_id=$1::uuid ORDER BY created_at DESC;
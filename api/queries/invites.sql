@@ -0,0 +1,19 @@
+-- name: InviteCreate :one
+INSERT INTO invites (code_hash, note, created_by, expires_at) VALUES ($1, $2, $3::uuid, $4)
+RETURNING id::text;
+
+-- name: InvitesList :many
+SELECT id::text, note, COALESCE(created_by::text, '') AS created_by, expires_at, used_at,
+       COALESCE(used_by::text, '') AS used_by, created_at
+FROM invites ORDER BY created_at DESC;
+
+-- name: InviteUse :one
+UPDATE invites SET used_at=now()
+WHERE code_hash=$1 AND used_at IS NULL AND (expires_at IS NULL OR expires_at > now())
+RETURNING id;
+
+-- name: InviteSetUsedBy :exec
+UPDATE invites SET used_by=$2::uuid WHERE id=$1::uuid;
+
+-- name: InviteDelete :exec
+DELETE FROM invites WHERE id=$1::uuid;
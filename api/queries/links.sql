@@ -1,15 +1,21 @@
 -- name: LinksBySource :many
-SELECT id::text, id_source::text, id_dest::text, tag FROM page_links WHERE id_source=$1::uuid;
+SELECT l.id::text, l.id_source::text, l.id_dest::text, l.tag, l.origin, l.anchor FROM page_links l
+JOIN pages d ON d.id=l.id_dest
+WHERE l.id_source=$1::uuid AND d.deleted_at IS NULL;
 
 -- name: LinkCreate :one
-INSERT INTO page_links (id_source,id_dest,tag) VALUES ($1::uuid,$2::uuid, NULLIF($3,''))
+INSERT INTO page_links (id_source,id_dest,tag,anchor) VALUES ($1::uuid,$2::uuid, NULLIF($3,''), NULLIF($4,''))
 RETURNING id::text;
 
 -- name: LinkDelete :exec
 DELETE FROM page_links WHERE id=$1::uuid;
 
--- name: LinksDeleteBySource :exec
-DELETE FROM page_links WHERE id_source=$1::uuid;
+-- name: LinksParsedBySource :many
+SELECT id::text, id_dest::text, COALESCE(anchor,'') AS anchor, COALESCE(tag,'') AS tag FROM page_links WHERE id_source=$1::uuid AND origin='parsed';
+
+-- name: LinkCreateParsed :exec
+INSERT INTO page_links (id_source,id_dest,anchor,tag,origin) VALUES ($1::uuid,$2::uuid, NULLIF($3,''), NULLIF($4,''),'parsed')
+ON CONFLICT (id_source,id_dest,(COALESCE(anchor,'')),(COALESCE(tag,''))) DO NOTHING;
 
 -- name: GraphByUser :many
 WITH mypages AS (
@@ -22,5 +28,6 @@ SELECT
   COALESCE(l.id_dest::text, '')   AS edge_to,
   l.tag
 FROM pages p
-LEFT JOIN page_links l ON l.id_source=p.id OR l.id_dest=p.id
-WHERE p.user_id=$1::uuid;
+LEFT JOIN page_links l ON (l.id_source=p.id OR l.id_dest=p.id)
+  AND NOT EXISTS (SELECT 1 FROM pages t WHERE t.id IN (l.id_source, l.id_dest) AND t.deleted_at IS NOT NULL)
+WHERE p.user_id=$1::uuid AND p.deleted_at IS NULL;
@@ -0,0 +1,7 @@
+-- name: ContentTotals :one
+SELECT
+  (SELECT count(*) FROM users) AS users,
+  (SELECT count(*) FROM pages WHERE deleted_at IS NULL) AS pages,
+  (SELECT count(*) FROM pages WHERE deleted_at IS NOT NULL) AS trashed,
+  (SELECT count(*) FROM page_links) AS links,
+  (SELECT COALESCE(sum(size_bytes), 0)::bigint FROM images) AS image_bytes;
@@ -3,21 +3,22 @@ INSERT INTO pages (user_id, name, body) VALUES ($1::uuid,$2,$3)
 RETURNING id::text;
 
 -- name: PagesByUser :many
-SELECT id::text, name, updated_at FROM pages WHERE user_id=$1::uuid ORDER BY updated_at DESC;
+SELECT id::text, name, updated_at FROM pages WHERE user_id=$1::uuid AND deleted_at IS NULL ORDER BY updated_at DESC;
 
 -- name: PagesAll :many
 SELECT p.id::text AS id, p.name, u.email AS owner_email, p.updated_at
 FROM pages p JOIN users u ON u.id=p.user_id
+WHERE p.deleted_at IS NULL
 ORDER BY p.updated_at DESC;
 
 -- name: PageByID :one
-SELECT id::text, user_id::text AS owner_id, name, body, updated_at FROM pages WHERE id=$1::uuid;
+SELECT id::text, user_id::text AS owner_id, name, body, updated_at FROM pages WHERE id=$1::uuid AND deleted_at IS NULL;
 
 -- name: PageOwner :one
-SELECT user_id::text FROM pages WHERE id=$1::uuid;
+SELECT user_id::text FROM pages WHERE id=$1::uuid AND deleted_at IS NULL;
 
 -- name: PageUpdate :exec
-UPDATE pages SET name=$2, body=$3 WHERE id=$1::uuid;
+UPDATE pages SET name=$2, body=$3 WHERE id=$1::uuid AND deleted_at IS NULL;
 
 -- name: PageDelete :exec
 DELETE FROM pages WHERE id=$1::uuid;
@@ -28,7 +29,49 @@ UPDATE pages SET user_id=$2::uuid WHERE id=$1::uuid;
 -- name: PagesWithOwners :many
 SELECT p.id::text AS id, p.name, u.id::text AS owner_id, u.email AS owner_email, p.updated_at
 FROM pages p JOIN users u ON u.id=p.user_id
+WHERE p.deleted_at IS NULL
 ORDER BY p.updated_at DESC;
 
 -- name: PageByNameAndUser :one
-SELECT id::text FROM pages WHERE user_id=$1::uuid AND name=$2 LIMIT 1;
+SELECT id::text FROM pages WHERE user_id=$1::uuid AND name=$2 AND deleted_at IS NULL LIMIT 1;
+
+-- name: PagesContentByUser :many
+SELECT id, name, body FROM pages WHERE user_id=$1::uuid AND deleted_at IS NULL ORDER BY created_at;
+
+-- name: PagesDeleteByUser :exec
+DELETE FROM pages WHERE user_id=$1::uuid;
+
+-- name: UserContentCounts :one
+SELECT
+  (SELECT count(*) FROM pages p WHERE p.user_id=$1::uuid AND p.deleted_at IS NULL) AS pages,
+  (SELECT count(*) FROM pages p WHERE p.user_id=$1::uuid AND p.deleted_at IS NOT NULL) AS trashed,
+  (SELECT count(*) FROM page_links l JOIN pages p ON p.id=l.id_source WHERE p.user_id=$1::uuid) AS links,
+  (SELECT count(*) FROM images i JOIN pages p ON p.id=i.page_id WHERE p.user_id=$1::uuid) AS images,
+  (SELECT count(*) FROM page_links l
+     JOIN pages d ON d.id=l.id_dest
+     JOIN pages s ON s.id=l.id_source
+   WHERE d.user_id=$1::uuid AND s.user_id<>$1::uuid) AS incoming_links;
+
+-- name: PageTrash :execrows
+UPDATE pages SET deleted_at=now() WHERE id=$1::uuid AND deleted_at IS NULL;
+
+-- name: PagesTrashByUser :many
+SELECT id::text, name, deleted_at FROM pages
+WHERE user_id=$1::uuid AND deleted_at IS NOT NULL
+ORDER BY deleted_at DESC;
+
+-- name: PageTrashedByID :one
+SELECT user_id, name, body FROM pages WHERE id=$1::uuid AND deleted_at IS NOT NULL;
+
+-- name: PageRestore :exec
+UPDATE pages SET deleted_at=NULL WHERE id=$1::uuid;
+
+-- name: PagesMentioning :many
+SELECT id, body FROM pages
+WHERE user_id=$1::uuid AND deleted_at IS NULL AND id<>$2::uuid AND strpos(body, $3::text) > 0;
+
+-- name: PagesPurgeTrashByUser :execrows
+DELETE FROM pages WHERE user_id=$1::uuid AND deleted_at IS NOT NULL;
+
+-- name: PagesPurgeTrashed :execrows
+DELETE FROM pages WHERE deleted_at < $1::timestamptz;
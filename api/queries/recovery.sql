@@ -0,0 +1,12 @@
+-- name: RecoveryCodeCreate :exec
+INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1::uuid, $2);
+
+-- name: RecoveryCodeUse :execrows
+UPDATE recovery_codes SET used_at=now()
+WHERE user_id=$1::uuid AND code_hash=$2 AND used_at IS NULL;
+
+-- name: RecoveryCodesLeft :one
+SELECT count(*) FROM recovery_codes WHERE user_id=$1::uuid AND used_at IS NULL;
+
+-- name: RecoveryCodesDeleteByUser :exec
+DELETE FROM recovery_codes WHERE user_id=$1::uuid;
@@ -0,0 +1,14 @@
+-- name: ResetCreate :exec
+INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES ($1::uuid, $2, $3);
+
+-- name: ResetPeek :one
+SELECT user_id FROM password_resets
+WHERE token_hash=$1 AND used_at IS NULL AND expires_at > now();
+
+-- name: ResetUse :one
+UPDATE password_resets SET used_at=now()
+WHERE token_hash=$1 AND used_at IS NULL AND expires_at > now()
+RETURNING user_id;
+
+-- name: ResetsDeleteByUser :exec
+DELETE FROM password_resets WHERE user_id=$1::uuid AND used_at IS NULL;
@@ -0,0 +1,6 @@
+-- name: SettingGet :one
+SELECT value FROM settings WHERE key=$1;
+
+-- name: SettingSet :exec
+INSERT INTO settings (key, value) VALUES ($1, $2)
+ON CONFLICT (key) DO UPDATE SET value=EXCLUDED.value;
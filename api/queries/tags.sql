@@ -0,0 +1,30 @@
+-- name: TagsByPage :many
+SELECT tag FROM page_tags WHERE page_id=$1::uuid;
+
+-- name: TagAdd :exec
+INSERT INTO page_tags (page_id, tag) VALUES ($1::uuid, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: TagDelete :exec
+DELETE FROM page_tags WHERE page_id=$1::uuid AND tag=$2;
+
+-- name: TagIndexPages :many
+SELECT id, body FROM pages;
+
+-- name: TagsByUser :many
+SELECT t.tag, count(*) AS pages
+FROM page_tags t JOIN pages p ON p.id=t.page_id
+WHERE p.user_id=$1::uuid AND p.deleted_at IS NULL
+GROUP BY t.tag
+ORDER BY t.tag;
+
+-- name: PagesByTag :many
+SELECT DISTINCT p.id::text, p.name, p.body, p.updated_at
+FROM pages p JOIN page_tags t ON t.page_id=p.id
+WHERE p.user_id=$1::uuid AND p.deleted_at IS NULL AND (t.tag=$2::text OR starts_with(t.tag, $2::text || '/'))
+ORDER BY p.updated_at DESC;
+
+-- name: GraphTagsByUser :many
+SELECT t.page_id::text, t.tag
+FROM page_tags t JOIN pages p ON p.id=t.page_id
+WHERE p.user_id=$1::uuid AND p.deleted_at IS NULL;
@@ -0,0 +1,24 @@
+-- name: AccessTokenCreate :one
+INSERT INTO access_tokens (user_id, name, token_hash, scope, expires_at)
+VALUES ($1::uuid, $2, $3, $4, $5)
+RETURNING id::text;
+
+-- name: AccessTokensByUser :many
+SELECT id::text, name, scope, expires_at, last_used_at, created_at
+FROM access_tokens WHERE user_id=$1::uuid ORDER BY created_at DESC;
+
+-- name: AccessTokenDelete :execrows
+DELETE FROM access_tokens WHERE id=$1::uuid AND user_id=$2::uuid;
+
+-- name: AccessTokensDeleteByUser :exec
+DELETE FROM access_tokens WHERE user_id=$1::uuid;
+
+-- name: AccessTokenLookup :one
+SELECT t.id, t.user_id::text, u.role, t.scope
+FROM access_tokens t JOIN users u ON u.id=t.user_id
+WHERE t.token_hash=$1 AND (t.expires_at IS NULL OR t.expires_at > now())
+  AND u.disabled_at IS NULL AND t.created_at > u.jwt_revoked_at;
+
+-- name: AccessTokenTouch :exec
+UPDATE access_tokens SET last_used_at=now()
+WHERE id=$1 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute');
@@ -1,15 +1,78 @@
 -- name: UserCreate :one
-INSERT INTO users (email, pass_hash) VALUES ($1,$2)
+INSERT INTO users (email, pass_hash, email_verified_at) VALUES ($1,$2,$3)
 RETURNING id::text;
 
 -- name: UserByEmail :one
-SELECT id, email, pass_hash, role FROM users WHERE email = $1;
+SELECT id, email, pass_hash, role, email_verified_at, locked_until, totp_enabled_at, disabled_at FROM users WHERE lower(email) = lower($1);
 
--- name: AdminSetPassword :exec
-UPDATE users SET pass_hash=$1 WHERE email='admin@local';
+-- name: AdminBootstrapPassword :execrows
+UPDATE users SET pass_hash=$1 WHERE email='admin@local' AND pass_hash='__TO_BE_SET__';
 
 -- name: UsersList :many
-SELECT id::text, email, role, jwt_revoked_at FROM users ORDER BY email;
+SELECT u.id::text, u.email, u.role, u.jwt_revoked_at, u.disabled_at, u.last_login_at,
+  (SELECT count(*) FROM pages p WHERE p.user_id=u.id AND p.deleted_at IS NULL) AS pages,
+  (SELECT count(*) FROM page_links l JOIN pages p ON p.id=l.id_source WHERE p.user_id=u.id) AS links,
+  (SELECT count(*) FROM images i JOIN pages p ON p.id=i.page_id WHERE p.user_id=u.id) AS images
+FROM users u ORDER BY u.email;
 
 -- name: UserDelete :exec
 DELETE FROM users WHERE id=$1::uuid;
+
+-- name: UserByID :one
+SELECT id, email, pass_hash, role, jwt_revoked_at, email_verified_at, failed_logins, locked_until, totp_secret, totp_enabled_at, totp_last_step, disabled_at, last_login_at FROM users WHERE id=$1::uuid;
+
+-- name: UserRevokedAt :one
+SELECT jwt_revoked_at FROM users WHERE id=$1::uuid AND disabled_at IS NULL;
+
+-- name: UserSetPassword :exec
+UPDATE users SET pass_hash=$2, jwt_revoked_at=now() WHERE id=$1::uuid;
+
+-- name: UserSetEmail :exec
+UPDATE users SET email=$2, email_verified_at=$3, jwt_revoked_at=now() WHERE id=$1::uuid;
+
+-- name: UserSetEmailVerified :exec
+UPDATE users SET email_verified_at=now() WHERE id=$1::uuid;
+
+-- name: UserLoginFailed :one
+UPDATE users SET
+  failed_logins = CASE WHEN failed_logins + 1 >= $2::int THEN 0 ELSE failed_logins + 1 END,
+  locked_until = CASE WHEN failed_logins + 1 >= $2::int THEN $3::timestamptz ELSE locked_until END
+WHERE id=$1::uuid
+RETURNING locked_until;
+
+-- name: UserUnlock :exec
+UPDATE users SET failed_logins=0, locked_until=NULL WHERE id=$1::uuid;
+
+-- name: UsersLocked :many
+SELECT id::text, email, locked_until FROM users WHERE locked_until > now() ORDER BY locked_until DESC;
+
+-- name: UserTotpSetSecret :exec
+UPDATE users SET totp_secret=$2 WHERE id=$1::uuid AND totp_enabled_at IS NULL;
+
+-- name: UserTotpEnable :exec
+UPDATE users SET totp_enabled_at=now(), totp_last_step=$2, jwt_revoked_at=now() WHERE id=$1::uuid;
+
+-- name: UserTotpDisable :exec
+UPDATE users SET totp_secret=NULL, totp_enabled_at=NULL, totp_last_step=0 WHERE id=$1::uuid;
+
+-- name: UserTotpUseStep :execrows
+UPDATE users SET totp_last_step=$2 WHERE id=$1::uuid AND totp_last_step < $2;
+
+-- name: UserSetRole :exec
+UPDATE users SET role=$2, jwt_revoked_at=now() WHERE id=$1::uuid;
+
+-- name: UsersCountByRole :one
+SELECT count(*) FROM users WHERE role=$1;
+
+-- name: AdminUserCreate :one
+INSERT INTO users (email, pass_hash, role, email_verified_at) VALUES ($1,$2,$3,now())
+RETURNING id::text;
+
+-- name: UserLoginSucceeded :exec
+UPDATE users SET failed_logins=0, locked_until=NULL, last_login_at=now() WHERE id=$1::uuid;
+
+-- name: UserDisable :exec
+UPDATE users SET disabled_at=now(), jwt_revoked_at=now() WHERE id=$1::uuid;
+
+-- name: UserEnable :exec
+UPDATE users SET disabled_at=NULL WHERE id=$1::uuid;
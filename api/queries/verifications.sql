@@ -0,0 +1,10 @@
+-- name: VerificationCreate :exec
+INSERT INTO email_verifications (user_id, token_hash, expires_at) VALUES ($1::uuid, $2, $3);
+
+-- name: VerificationUse :one
+UPDATE email_verifications SET used_at=now()
+WHERE token_hash=$1 AND used_at IS NULL AND expires_at > now()
+RETURNING user_id;
+
+-- name: VerificationsDeleteByUser :exec
+DELETE FROM email_verifications WHERE user_id=$1::uuid AND used_at IS NULL;